@@ -1,67 +1,162 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Email verification policies applied to accounts without a verified email
+const (
+	EmailVerificationNone     = "none"
+	EmailVerificationRestrict = "restrict"
+	EmailVerificationRefuse   = "refuse"
+)
+
 // Config struct
 type Config struct {
-	GinMode            string
-	Port               string
-	JWTSecret          string
-	DatabaseURL        string
-	AWSRegion          string
-	AWSAccessKeyID     string
-	AWSSecretAccessKey string
-	AWSBucket          string
-	RedisHost          string
-	RedisPassword      string
-	RedisDB            int
-	RedisExpires       time.Duration
-	GoogleClientID     string
-	GoogleClientSecret string
-	FrontendURL        string
-	EmailHost          string
-	EmailPort          string
-	EmailHostUser      string
-	EmailHostPassword  string
-	RabbitMQHost       string
-	RabbitMQPort       string
-	RabbitMQUser       string
-	RabbitMQPassword   string
-	Host               string
-	Domain             string
+	GinMode                 string
+	Port                    string
+	JWTSecret               string
+	DatabaseURL             string
+	AWSRegion               string
+	AWSAccessKeyID          string
+	AWSSecretAccessKey      string
+	AWSBucket               string
+	RedisHost               string
+	RedisPassword           string
+	RedisDB                 int
+	RedisExpires            time.Duration
+	GoogleClientID          string
+	GoogleClientSecret      string
+	FrontendURL             string
+	AppName                 string
+	AppLogoURL              string
+	EmailHost               string
+	EmailPort               string
+	EmailHostUser           string
+	EmailHostPassword       string
+	EmailDriver             string
+	EmailSecurity           string
+	EmailOutboxDir          string
+	EmailListUnsubscribe    []string
+	MailgunDomain           string
+	MailgunAPIKey           string
+	MailgunAPIBase          string
+	RabbitMQHost            string
+	RabbitMQPort            string
+	RabbitMQUser            string
+	RabbitMQPassword        string
+	RabbitMQChannelPoolSize int
+	EventsExchange          string
+	OutboxPollInterval      time.Duration
+	WebhookPollInterval     time.Duration
+	Host                    string
+	Domain                  string
+	EmailVerificationPolicy string
+	CookieMode              bool
+	CookieDomain            string
+	CookieSecure            bool
+	CookieSameSite          string
+	CORS                    CORSPolicy
+	CORSGroups              []CORSPolicy
+}
+
+// CORSPolicy is the CORS configuration of a group of routes, origins accept
+// wildcard subdomain patterns such as https://*.example.com
+type CORSPolicy struct {
+	Paths            []string
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
 }
 
 func New() *Config {
-	return &Config{
-		GinMode:            getEnv("GIN_MODE", "debug"),
-		Port:               getEnv("PORT", "8080"),
-		JWTSecret:          getEnv("JWT_SECRET", ""),
-		DatabaseURL:        getEnv("DATABASE_URL", ""),
-		AWSRegion:          getEnv("AWS_REGION", ""),
-		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
-		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
-		AWSBucket:          getEnv("AWS_BUCKET", ""),
-		RedisHost:          getEnv("REDIS_HOST", ""),
-		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
-		RedisDB:            getEnvAsInt("REDIS_DB", 0),
-		RedisExpires:       getEnvAsTimeDuration("REDIS_EXPIRES", 10),
-		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-		FrontendURL:        getEnv("FRONTEND_URL", ""),
-		EmailHost:          getEnv("EMAIL_HOST", ""),
-		EmailPort:          getEnv("EMAIL_PORT", ""),
-		EmailHostUser:      getEnv("EMAIL_HOST_USER", ""),
-		EmailHostPassword:  getEnv("EMAIL_HOST_PASSWORD", ""),
-		RabbitMQHost:       getEnv("RABBITMQ_HOST", ""),
-		RabbitMQPort:       getEnv("RABBITMQ_PORT", ""),
-		RabbitMQUser:       getEnv("RABBITMQ_USER", ""),
-		RabbitMQPassword:   getEnv("RABBITMQ_PASSWORD", ""),
-		Host:               getEnv("HOST", ""),
-		Domain:             getEnv("DOMAIN", "localhost:8080"),
+	conf := &Config{
+		GinMode:                 getEnv("GIN_MODE", "debug"),
+		Port:                    getEnv("PORT", "8080"),
+		JWTSecret:               getEnv("JWT_SECRET", ""),
+		DatabaseURL:             getEnv("DATABASE_URL", ""),
+		AWSRegion:               getEnv("AWS_REGION", ""),
+		AWSAccessKeyID:          getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:      getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSBucket:               getEnv("AWS_BUCKET", ""),
+		RedisHost:               getEnv("REDIS_HOST", ""),
+		RedisPassword:           getEnv("REDIS_PASSWORD", ""),
+		RedisDB:                 getEnvAsInt("REDIS_DB", 0),
+		RedisExpires:            getEnvAsTimeDuration("REDIS_EXPIRES", 10),
+		GoogleClientID:          getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:      getEnv("GOOGLE_CLIENT_SECRET", ""),
+		FrontendURL:             getEnv("FRONTEND_URL", ""),
+		AppName:                 getEnv("APP_NAME", "Mi Tour"),
+		AppLogoURL:              getEnv("APP_LOGO_URL", ""),
+		EmailHost:               getEnv("EMAIL_HOST", ""),
+		EmailPort:               getEnv("EMAIL_PORT", ""),
+		EmailHostUser:           getEnv("EMAIL_HOST_USER", ""),
+		EmailHostPassword:       getEnv("EMAIL_HOST_PASSWORD", ""),
+		EmailDriver:             getEnv("EMAIL_DRIVER", "smtp"),
+		EmailSecurity:           getEnv("EMAIL_SECURITY", ""),
+		EmailOutboxDir:          getEnv("EMAIL_OUTBOX_DIR", "tmp/emails"),
+		EmailListUnsubscribe:    getEnvAsSlice("EMAIL_LIST_UNSUBSCRIBE", nil),
+		MailgunDomain:           getEnv("MAILGUN_DOMAIN", ""),
+		MailgunAPIKey:           getEnv("MAILGUN_API_KEY", ""),
+		MailgunAPIBase:          getEnv("MAILGUN_API_BASE", ""),
+		RabbitMQHost:            getEnv("RABBITMQ_HOST", ""),
+		RabbitMQPort:            getEnv("RABBITMQ_PORT", ""),
+		RabbitMQUser:            getEnv("RABBITMQ_USER", ""),
+		RabbitMQPassword:        getEnv("RABBITMQ_PASSWORD", ""),
+		RabbitMQChannelPoolSize: getEnvAsInt("RABBITMQ_CHANNEL_POOL_SIZE", 8),
+		EventsExchange:          getEnv("EVENTS_EXCHANGE", "auth.events"),
+		OutboxPollInterval:      getEnvAsPositiveTimeDuration("OUTBOX_POLL_INTERVAL", 1),
+		WebhookPollInterval:     getEnvAsPositiveTimeDuration("WEBHOOK_POLL_INTERVAL", 5),
+		Host:                    getEnv("HOST", ""),
+		Domain:                  getEnv("DOMAIN", "localhost:8080"),
+		EmailVerificationPolicy: getEnv("EMAIL_VERIFICATION_POLICY", EmailVerificationNone),
+		CookieMode:              getEnvAsBool("COOKIE_MODE", false),
+		CookieDomain:            getEnv("COOKIE_DOMAIN", ""),
+		CookieSecure:            getEnvAsBool("COOKIE_SECURE", true),
+		CookieSameSite:          getEnv("COOKIE_SAME_SITE", "lax"),
+	}
+
+	// Any origin may call the API with a bearer token. Credentials are only
+	// allowed in cookie mode, which then requires the allowed origins
+	conf.CORS = getCORSPolicy("CORS", CORSPolicy{
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-CSRF-Token", "X-Application-Id"},
+		AllowCredentials: conf.CookieMode,
+		MaxAge:           12 * time.Hour,
+	})
+
+	// Route groups fall back to the default policy for unset values
+	auth := conf.CORS
+	auth.Paths = []string{"/auth/"}
+	admin := conf.CORS
+	admin.Paths = []string{"/roles/", "/user_roles/", "/audit", "/webhooks/", "/emails/", "/email-templates/", "/applications/", "/invitations", "/admin/"}
+
+	conf.CORSGroups = []CORSPolicy{
+		getCORSPolicy("CORS_AUTH", auth),
+		getCORSPolicy("CORS_ADMIN", admin),
+	}
+
+	return conf
+}
+
+// getCORSPolicy reads the CORS variables with the given prefix
+func getCORSPolicy(prefix string, fallback CORSPolicy) CORSPolicy {
+	return CORSPolicy{
+		Paths:            getEnvAsSlice(prefix+"_PATHS", fallback.Paths),
+		AllowOrigins:     getEnvAsSlice(prefix+"_ALLOW_ORIGINS", fallback.AllowOrigins),
+		AllowMethods:     getEnvAsSlice(prefix+"_ALLOW_METHODS", fallback.AllowMethods),
+		AllowHeaders:     getEnvAsSlice(prefix+"_ALLOW_HEADERS", fallback.AllowHeaders),
+		ExposeHeaders:    getEnvAsSlice(prefix+"_EXPOSE_HEADERS", fallback.ExposeHeaders),
+		AllowCredentials: getEnvAsBool(prefix+"_ALLOW_CREDENTIALS", fallback.AllowCredentials),
+		MaxAge:           getEnvAsTimeDuration(prefix+"_MAX_AGE", fallback.MaxAge/time.Second) * time.Second,
 	}
 }
 
@@ -92,3 +187,38 @@ func getEnvAsTimeDuration(key string, fallback time.Duration) time.Duration {
 	}
 	return fallback
 }
+
+// getEnvAsPositiveTimeDuration reads a duration that must be positive, such
+// as a ticker interval, falling back on a value that is not
+func getEnvAsPositiveTimeDuration(key string, fallback time.Duration) time.Duration {
+	d := getEnvAsTimeDuration(key, fallback)
+	if d <= 0 {
+		log.Printf("%s must be positive, using %d", key, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvAsBool func
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// getEnvAsSlice func
+func getEnvAsSlice(key string, fallback []string) []string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return fallback
+}
@@ -14,6 +14,7 @@ require (
 	github.com/mailgun/mailgun-go/v4 v4.8.2
 	github.com/segmentio/ksuid v1.0.4
 	github.com/streadway/amqp v1.0.0
+	github.com/stretchr/testify v1.8.4
 	golang.org/x/crypto v0.6.0
 	golang.org/x/oauth2 v0.5.0
 	google.golang.org/api v0.111.0
@@ -50,7 +51,6 @@ require (
 	github.com/pelletier/go-toml/v2 v2.0.6 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.9 // indirect
 	go.opencensus.io v0.24.0 // indirect
@@ -2,37 +2,57 @@ package cache
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v7"
 	"github.com/tapiaw38/auth-api/internal/models"
 )
 
+// Cache namespaces. Moving a namespace to a new version drops all its keys
+// at once, the keys of the old version expire on their own
+const (
+	// NamespaceUsers holds the users listings
+	NamespaceUsers = "users"
+	// NamespaceProfiles holds the single users by id
+	NamespaceProfiles = "profiles"
+)
+
 // RedisCache is the redis cache configuration
 type RedisCache struct {
 	Host     string
 	Password string
 	DB       int
 	Expires  time.Duration
+
+	client *redis.Client
 }
 
-// NewRedisCache creates a new redis cache
+// NewRedisCache creates a new redis cache with its connection pool, shared
+// by every call until Close
 func NewRedisCache(config *RedisCache) *RedisCache {
 	return &RedisCache{
 		Host:     config.Host,
 		Password: config.Password,
 		DB:       config.DB,
 		Expires:  config.Expires,
+		client: redis.NewClient(&redis.Options{
+			Addr:     config.Host,
+			Password: config.Password,
+			DB:       config.DB,
+		}),
 	}
 }
 
 // GetClient returns the redis client
 func (cache *RedisCache) GetClient() *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:     cache.Host,
-		Password: cache.Password,
-		DB:       cache.DB,
-	})
+	return cache.client
+}
+
+// Close closes the connection pool of the cache
+func (cache *RedisCache) Close() error {
+	return cache.client.Close()
 }
 
 // GetValue gets a user from the cache
@@ -70,6 +90,26 @@ func (c *RedisCache) SetValue(key string, value interface{}) error {
 	return nil
 }
 
+// GetObject gets a value from the cache into the struct pointed by value
+func (c *RedisCache) GetObject(key string, value interface{}) error {
+	client := c.GetClient()
+
+	val, err := client.Get(key).Result()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(val), value)
+}
+
+// Allow reports whether the action identified by key may run, allowing it
+// at most once per window
+func (c *RedisCache) Allow(key string, window time.Duration) (bool, error) {
+	client := c.GetClient()
+
+	return client.SetNX(key, time.Now().Unix(), window).Result()
+}
+
 // SetUser sets a user in the cache
 func (c *RedisCache) SetUser(key string, user *models.User) error {
 	client := c.GetClient()
@@ -138,3 +178,55 @@ func (c *RedisCache) GetUsers(key string) ([]*models.User, error) {
 
 	return users, nil
 }
+
+// IsMiss reports whether an error of a get is only a missing key
+func IsMiss(err error) bool {
+	return err == redis.Nil
+}
+
+// Key returns the key of the given parts within the current version of a
+// namespace
+func (c *RedisCache) Key(namespace string, parts ...string) (string, error) {
+	client := c.GetClient()
+
+	version, err := client.Get("version:" + namespace).Int64()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	return namespace + ":v" + strconv.FormatInt(version, 10) + ":" + strings.Join(parts, ":"), nil
+}
+
+// Invalidate drops every key of a namespace by moving it to a new version
+func (c *RedisCache) Invalidate(namespace string) error {
+	client := c.GetClient()
+
+	return client.Incr("version:" + namespace).Err()
+}
+
+// InvalidateUser drops the cached profile of a user and the users listings
+func (c *RedisCache) InvalidateUser(userId string) error {
+	key, err := c.Key(NamespaceProfiles, userId)
+	if err != nil {
+		return err
+	}
+
+	client := c.GetClient()
+
+	err = client.Del(key).Err()
+	if err != nil {
+		return err
+	}
+
+	return c.Invalidate(NamespaceUsers)
+}
+
+// InvalidateUsers drops every cached profile and the users listings
+func (c *RedisCache) InvalidateUsers() error {
+	err := c.Invalidate(NamespaceProfiles)
+	if err != nil {
+		return err
+	}
+
+	return c.Invalidate(NamespaceUsers)
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// applicationFields is the list of columns scanned by ScanRowApplication
+const applicationFields = `id, name, frontend_url, sender_name, sender_address,
+			logo_url, template_set, is_active, created_at, updated_at`
+
+// InsertApplication inserts a new application into the database
+func (repository *PostgresRepository) InsertApplication(ctx context.Context, application *models.Application) (*models.Application, error) {
+	q := `
+		INSERT INTO applications (
+			id, name, frontend_url, sender_name, sender_address,
+			logo_url, template_set, is_active, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		RETURNING ` + applicationFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		application.Id, application.Name, application.FrontendURL,
+		application.SenderName, application.SenderAddress,
+		application.LogoURL, application.TemplateSet, application.IsActive,
+		time.Now(),
+	)
+
+	return ScanRowApplication(row)
+}
+
+// listApplicationByQuery returns the applications returned by the given query
+func (repository *PostgresRepository) listApplicationByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.Application, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var applications []*models.Application
+
+	for rows.Next() {
+		application, err := ScanRowApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, application)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+// GetApplicationById returns an application by id
+func (repository *PostgresRepository) GetApplicationById(ctx context.Context, id string) (*models.Application, error) {
+	q := `
+		SELECT ` + applicationFields + `
+		FROM applications
+		WHERE id = $1;
+	`
+
+	applications, err := repository.listApplicationByQuery(ctx, q, id)
+	if err != nil || len(applications) == 0 {
+		return nil, err
+	}
+
+	return applications[0], nil
+}
+
+// ListApplication returns all applications
+func (repository *PostgresRepository) ListApplication(ctx context.Context) ([]*models.Application, error) {
+	q := `
+		SELECT ` + applicationFields + `
+		FROM applications
+		ORDER BY created_at;
+	`
+
+	return repository.listApplicationByQuery(ctx, q)
+}
+
+// UpdateApplication updates an application in the database
+func (repository *PostgresRepository) UpdateApplication(ctx context.Context, application *models.Application) (*models.Application, error) {
+	q := `
+		UPDATE applications
+		SET
+			name = $1, frontend_url = $2, sender_name = $3,
+			sender_address = $4, logo_url = $5, template_set = $6,
+			is_active = $7, updated_at = $8
+		WHERE id = $9
+		RETURNING ` + applicationFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		application.Name, application.FrontendURL, application.SenderName,
+		application.SenderAddress, application.LogoURL, application.TemplateSet,
+		application.IsActive, time.Now(), application.Id,
+	)
+
+	return ScanRowApplication(row)
+}
+
+// DeleteApplication deletes an application, its users are kept with the
+// default branding
+func (repository *PostgresRepository) DeleteApplication(ctx context.Context, id string) error {
+	q := `
+		DELETE FROM applications
+		WHERE id = $1;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// auditLogFields is the list of columns scanned by ScanRowAuditLog
+const auditLogFields = `id, actor_id, target_id, action, outcome,
+			ip, user_agent, metadata, created_at`
+
+// InsertAuditLog appends an event to the audit log
+func (repository *PostgresRepository) InsertAuditLog(ctx context.Context, auditLog *models.AuditLog) error {
+	metadata := []byte("{}")
+	if auditLog.Metadata != nil {
+		var err error
+		metadata, err = json.Marshal(auditLog.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	q := `
+		INSERT INTO audit_logs (
+			id, actor_id, target_id, action, outcome,
+			ip, user_agent, metadata, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`
+
+	_, err := repository.conn(ctx).ExecContext(
+		ctx, q,
+		auditLog.Id, nullString(auditLog.ActorId), nullString(auditLog.TargetId),
+		auditLog.Action, auditLog.Outcome,
+		nullString(auditLog.Ip), nullString(auditLog.UserAgent),
+		metadata, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListAuditLog returns the audit logs matching the filter, newest first
+func (repository *PostgresRepository) ListAuditLog(ctx context.Context, filter *models.AuditLogFilter) ([]*models.AuditLog, error) {
+	conditions := []string{}
+	values := []interface{}{}
+
+	// next returns the placeholder of a new value
+	next := func(value interface{}) string {
+		values = append(values, value)
+		return "$" + strconv.Itoa(len(values))
+	}
+
+	if filter.UserId != "" {
+		placeholder := next(filter.UserId)
+		conditions = append(conditions, "(actor_id = "+placeholder+" OR target_id = "+placeholder+")")
+	}
+
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+next(filter.Action))
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+next(filter.From))
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < "+next(filter.To))
+	}
+
+	if filter.CursorId != "" {
+		conditions = append(conditions, "(created_at, id) < ("+next(filter.CursorCreatedAt)+", "+next(filter.CursorId)+")")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	q := `
+		SELECT ` + auditLogFields + `
+		FROM audit_logs
+		` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + next(filter.Limit) + `;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var auditLogs []*models.AuditLog
+
+	for rows.Next() {
+		auditLog, err := ScanRowAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		auditLogs = append(auditLogs, auditLog)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return auditLogs, nil
+}
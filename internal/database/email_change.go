@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// emailChangeFields is the list of columns scanned by ScanRowEmailChange
+const emailChangeFields = `id, user_id, old_email, new_email,
+			expires_at, confirmed_at, created_at`
+
+// InsertEmailChange inserts a pending email change, replacing any previous
+// pending change of the same user
+func (repository *PostgresRepository) InsertEmailChange(ctx context.Context, emailChange *models.EmailChange) (*models.EmailChange, error) {
+	q := `
+		INSERT INTO email_changes (
+			id, user_id, old_email, new_email, expires_at, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET id = EXCLUDED.id, old_email = EXCLUDED.old_email,
+			new_email = EXCLUDED.new_email,
+			expires_at = EXCLUDED.expires_at,
+			confirmed_at = NULL,
+			created_at = EXCLUDED.created_at
+		RETURNING ` + emailChangeFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		emailChange.Id, emailChange.UserId, emailChange.OldEmail,
+		emailChange.NewEmail, emailChange.ExpiresAt,
+	)
+
+	ec, err := ScanRowEmailChange(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec, nil
+}
+
+// GetEmailChangeByUserId returns the pending, or confirmed but still
+// revertible, email change of a user
+func (repository *PostgresRepository) GetEmailChangeByUserId(ctx context.Context, userId string) (*models.EmailChange, error) {
+	q := `
+		SELECT ` + emailChangeFields + `
+		FROM email_changes
+		WHERE user_id = $1;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var emailChange *models.EmailChange
+
+	for rows.Next() {
+		emailChange, err = ScanRowEmailChange(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emailChange, nil
+}
+
+// ConfirmEmailChange marks a pending email change as applied
+func (repository *PostgresRepository) ConfirmEmailChange(ctx context.Context, id string) error {
+	q := `
+		UPDATE email_changes
+		SET confirmed_at = $1
+		WHERE id = $2
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteEmailChange deletes an email change
+func (repository *PostgresRepository) DeleteEmailChange(ctx context.Context, id string) error {
+	q := `
+		DELETE FROM email_changes
+		WHERE id = $1
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
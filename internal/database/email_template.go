@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// emailTemplateFields is the list of columns scanned by ScanRowEmailTemplate
+const emailTemplateFields = `id, name, locale, template_set, subject,
+			html, text, created_at, updated_at`
+
+// UpsertEmailTemplate inserts the override of a template in a locale and
+// template set, or replaces the existing one
+func (repository *PostgresRepository) UpsertEmailTemplate(ctx context.Context, template *models.EmailTemplate) (*models.EmailTemplate, error) {
+	q := `
+		INSERT INTO email_templates (
+			id, name, locale, template_set, subject, html, text,
+			created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (name, locale, template_set) DO UPDATE
+		SET subject = EXCLUDED.subject, html = EXCLUDED.html,
+			text = EXCLUDED.text, updated_at = EXCLUDED.updated_at
+		RETURNING ` + emailTemplateFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		template.Id, template.Name, template.Locale, template.TemplateSet,
+		template.Subject, template.HTML, template.Text,
+		time.Now(),
+	)
+
+	return ScanRowEmailTemplate(row)
+}
+
+// listEmailTemplateByQuery returns the email templates returned by the given query
+func (repository *PostgresRepository) listEmailTemplateByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.EmailTemplate, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var templates []*models.EmailTemplate
+
+	for rows.Next() {
+		template, err := ScanRowEmailTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// GetEmailTemplate returns the override of a template in a locale and template set
+func (repository *PostgresRepository) GetEmailTemplate(ctx context.Context, name string, locale string, templateSet string) (*models.EmailTemplate, error) {
+	q := `
+		SELECT ` + emailTemplateFields + `
+		FROM email_templates
+		WHERE name = $1 AND locale = $2 AND template_set = $3;
+	`
+
+	templates, err := repository.listEmailTemplateByQuery(ctx, q, name, locale, templateSet)
+	if err != nil || len(templates) == 0 {
+		return nil, err
+	}
+
+	return templates[0], nil
+}
+
+// ListEmailTemplate returns every template override
+func (repository *PostgresRepository) ListEmailTemplate(ctx context.Context) ([]*models.EmailTemplate, error) {
+	q := `
+		SELECT ` + emailTemplateFields + `
+		FROM email_templates
+		ORDER BY template_set, name, locale;
+	`
+
+	return repository.listEmailTemplateByQuery(ctx, q)
+}
+
+// ListEmailTemplateByName returns the overrides of a template in every
+// locale and template set
+func (repository *PostgresRepository) ListEmailTemplateByName(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+	q := `
+		SELECT ` + emailTemplateFields + `
+		FROM email_templates
+		WHERE name = $1;
+	`
+
+	return repository.listEmailTemplateByQuery(ctx, q, name)
+}
+
+// DeleteEmailTemplate deletes the override of a template in a locale and template set
+func (repository *PostgresRepository) DeleteEmailTemplate(ctx context.Context, name string, locale string, templateSet string) error {
+	q := `
+		DELETE FROM email_templates
+		WHERE name = $1 AND locale = $2 AND template_set = $3;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, name, locale, templateSet)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 
+	"github.com/lib/pq"
 	"github.com/tapiaw38/auth-api/internal/models"
 )
 
@@ -11,11 +13,20 @@ type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
+// nullString converts an empty string into a SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt converts a zero int into a SQL NULL
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
 // ScanRowUser scans a row into a User struct
 func ScanRowUser(s scanner) (*models.User, error) {
 	u := models.User{}
-	var lastName, picture, phoneNumber, address, password sql.NullString
-	var verifiedEmailToken, passwordResetToken sql.NullString
+	var lastName, picture, phoneNumber, address, password, applicationId sql.NullString
 
 	err := s.Scan(
 		&u.Id,
@@ -29,10 +40,9 @@ func ScanRowUser(s scanner) (*models.User, error) {
 		&address,
 		&u.IsActive,
 		&u.VerifiedEmail,
-		&verifiedEmailToken,
-		&u.VerifiedEmailTokenExpiry,
-		&passwordResetToken,
-		&u.PasswordResetTokenExpiry,
+		&u.TokenVersion,
+		&u.Locale,
+		&applicationId,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -57,12 +67,8 @@ func ScanRowUser(s scanner) (*models.User, error) {
 		u.Password = password.String
 	}
 
-	if verifiedEmailToken.Valid {
-		u.VerifiedEmailToken = verifiedEmailToken.String
-	}
-
-	if passwordResetToken.Valid {
-		u.PasswordResetToken = passwordResetToken.String
+	if applicationId.Valid {
+		u.ApplicationId = applicationId.String
 	}
 
 	if err != nil {
@@ -101,3 +107,393 @@ func ScanRowUserRole(s scanner) (*models.UserRole, error) {
 
 	return &ur, nil
 }
+
+// ScanRowEmailChange scans a row into an EmailChange struct
+func ScanRowEmailChange(s scanner) (*models.EmailChange, error) {
+	ec := models.EmailChange{}
+
+	var confirmedAt sql.NullTime
+
+	err := s.Scan(
+		&ec.Id,
+		&ec.UserId,
+		&ec.OldEmail,
+		&ec.NewEmail,
+		&ec.ExpiresAt,
+		&confirmedAt,
+		&ec.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		ec.ConfirmedAt = confirmedAt.Time
+	}
+
+	return &ec, nil
+}
+
+// ScanRowOneTimeToken scans a row into a OneTimeToken struct
+func ScanRowOneTimeToken(s scanner) (*models.OneTimeToken, error) {
+	t := models.OneTimeToken{}
+	var usedAt sql.NullTime
+
+	err := s.Scan(
+		&t.Id,
+		&t.UserId,
+		&t.Purpose,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&usedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		t.UsedAt = usedAt.Time
+	}
+
+	return &t, nil
+}
+
+// ScanRowSession scans a row into a Session struct
+func ScanRowSession(s scanner) (*models.Session, error) {
+	ss := models.Session{}
+	var userAgent, ip, organizationId, refreshTokenHash sql.NullString
+	var refreshTokenExpiresAt, revokedAt sql.NullTime
+
+	err := s.Scan(
+		&ss.Id,
+		&ss.UserId,
+		&userAgent,
+		&ip,
+		&ss.TokenFamily,
+		&organizationId,
+		&refreshTokenHash,
+		&refreshTokenExpiresAt,
+		&ss.CreatedAt,
+		&ss.LastSeenAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if organizationId.Valid {
+		ss.OrganizationId = organizationId.String
+	}
+
+	if refreshTokenHash.Valid {
+		ss.RefreshTokenHash = refreshTokenHash.String
+	}
+
+	if refreshTokenExpiresAt.Valid {
+		ss.RefreshTokenExpiresAt = refreshTokenExpiresAt.Time
+	}
+
+	if userAgent.Valid {
+		ss.UserAgent = userAgent.String
+	}
+
+	if ip.Valid {
+		ss.Ip = ip.String
+	}
+
+	if revokedAt.Valid {
+		ss.RevokedAt = revokedAt.Time
+	}
+
+	return &ss, nil
+}
+
+// ScanRowAuditLog scans a row into an AuditLog struct
+func ScanRowAuditLog(s scanner) (*models.AuditLog, error) {
+	a := models.AuditLog{}
+	var actorId, targetId, ip, userAgent sql.NullString
+	var metadata []byte
+
+	err := s.Scan(
+		&a.Id,
+		&actorId,
+		&targetId,
+		&a.Action,
+		&a.Outcome,
+		&ip,
+		&userAgent,
+		&metadata,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorId.Valid {
+		a.ActorId = actorId.String
+	}
+
+	if targetId.Valid {
+		a.TargetId = targetId.String
+	}
+
+	if ip.Valid {
+		a.Ip = ip.String
+	}
+
+	if userAgent.Valid {
+		a.UserAgent = userAgent.String
+	}
+
+	if len(metadata) > 0 {
+		if err = json.Unmarshal(metadata, &a.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
+
+// ScanRowEvent scans a row into an Event struct
+func ScanRowEvent(s scanner) (*models.Event, error) {
+	e := models.Event{}
+	var payload []byte
+
+	err := s.Scan(
+		&e.Id,
+		&e.Type,
+		&e.Version,
+		&payload,
+		&e.OccurredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Payload = payload
+
+	return &e, nil
+}
+
+// ScanRowWebhook scans a row into a Webhook struct
+func ScanRowWebhook(s scanner) (*models.Webhook, error) {
+	w := models.Webhook{}
+
+	err := s.Scan(
+		&w.Id,
+		&w.Url,
+		&w.Secret,
+		pq.Array(&w.EventTypes),
+		&w.IsActive,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// ScanRowWebhookDelivery scans a row into a WebhookDelivery struct
+func ScanRowWebhookDelivery(s scanner) (*models.WebhookDelivery, error) {
+	d := models.WebhookDelivery{}
+	var payload []byte
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+
+	err := s.Scan(
+		&d.Id,
+		&d.WebhookId,
+		&d.EventId,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&lastStatusCode,
+		&lastError,
+		&deliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = payload
+
+	if lastStatusCode.Valid {
+		d.LastStatusCode = int(lastStatusCode.Int64)
+	}
+
+	if lastError.Valid {
+		d.LastError = lastError.String
+	}
+
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return &d, nil
+}
+
+// ScanRowOutboxEmail scans a row into an OutboxEmail struct
+func ScanRowOutboxEmail(s scanner) (*models.OutboxEmail, error) {
+	e := models.OutboxEmail{}
+	var message []byte
+
+	err := s.Scan(
+		&e.Id,
+		&message,
+		&e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(message, &e.Message); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// ScanRowEmailTemplate scans a row into an EmailTemplate struct
+func ScanRowEmailTemplate(s scanner) (*models.EmailTemplate, error) {
+	t := models.EmailTemplate{}
+
+	err := s.Scan(
+		&t.Id,
+		&t.Name,
+		&t.Locale,
+		&t.TemplateSet,
+		&t.Subject,
+		&t.HTML,
+		&t.Text,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// ScanRowApplication scans a row into an Application struct
+func ScanRowApplication(s scanner) (*models.Application, error) {
+	a := models.Application{}
+
+	err := s.Scan(
+		&a.Id,
+		&a.Name,
+		&a.FrontendURL,
+		&a.SenderName,
+		&a.SenderAddress,
+		&a.LogoURL,
+		&a.TemplateSet,
+		&a.IsActive,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// ScanRowOrganization scans a row into an Organization struct
+func ScanRowOrganization(s scanner) (*models.Organization, error) {
+	o := models.Organization{}
+
+	err := s.Scan(
+		&o.Id,
+		&o.Name,
+		&o.Slug,
+		&o.IsActive,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+// ScanRowMembership scans a row into a Membership struct
+func ScanRowMembership(s scanner) (*models.Membership, error) {
+	m := models.Membership{}
+	var invitedBy sql.NullString
+
+	err := s.Scan(
+		&m.OrganizationId,
+		&m.UserId,
+		&m.Status,
+		&invitedBy,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitedBy.Valid {
+		m.InvitedBy = invitedBy.String
+	}
+
+	return &m, nil
+}
+
+// ScanRowInvitation scans a row into an Invitation struct
+func ScanRowInvitation(s scanner) (*models.Invitation, error) {
+	i := models.Invitation{}
+	var applicationId, invitedBy, acceptedBy sql.NullString
+	var acceptedAt, revokedAt sql.NullTime
+
+	err := s.Scan(
+		&i.Id,
+		&i.Email,
+		&i.FirstName,
+		&i.LastName,
+		pq.Array(&i.RoleIds),
+		&applicationId,
+		&i.Locale,
+		&invitedBy,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&acceptedAt,
+		&acceptedBy,
+		&revokedAt,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if applicationId.Valid {
+		i.ApplicationId = applicationId.String
+	}
+
+	if invitedBy.Valid {
+		i.InvitedBy = invitedBy.String
+	}
+
+	if acceptedAt.Valid {
+		i.AcceptedAt = acceptedAt.Time
+	}
+
+	if acceptedBy.Valid {
+		i.AcceptedBy = acceptedBy.String
+	}
+
+	if revokedAt.Valid {
+		i.RevokedAt = revokedAt.Time
+	}
+
+	return &i, nil
+}
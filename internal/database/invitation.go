@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// invitationFields is the list of columns scanned by ScanRowInvitation
+const invitationFields = `id, email, first_name, last_name, role_ids,
+			application_id, locale, invited_by, token_hash, expires_at,
+			accepted_at, accepted_by, revoked_at, created_at`
+
+// InsertInvitation inserts a new invitation into the database, revoking
+// the pending invitations of the same email
+func (repository *PostgresRepository) InsertInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	var inv *models.Invitation
+
+	err := repository.WithTx(ctx, func(ctx context.Context) error {
+		q := `
+			UPDATE invitations
+			SET revoked_at = $1
+			WHERE lower(email) = lower($2)
+				AND accepted_at IS NULL AND revoked_at IS NULL;
+		`
+
+		_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), invitation.Email)
+		if err != nil {
+			return err
+		}
+
+		q = `
+			INSERT INTO invitations (
+				id, email, first_name, last_name, role_ids, application_id,
+				locale, invited_by, token_hash, expires_at, created_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING ` + invitationFields + `;
+		`
+
+		row := repository.conn(ctx).QueryRowContext(
+			ctx, q,
+			invitation.Id, invitation.Email, invitation.FirstName,
+			invitation.LastName, pq.Array(invitation.RoleIds),
+			nullString(invitation.ApplicationId), invitation.Locale,
+			nullString(invitation.InvitedBy), invitation.TokenHash,
+			invitation.ExpiresAt, time.Now(),
+		)
+
+		inv, err = ScanRowInvitation(row)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// listInvitationByQuery returns the invitations returned by the given query
+func (repository *PostgresRepository) listInvitationByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.Invitation, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var invitations []*models.Invitation
+
+	for rows.Next() {
+		invitation, err := ScanRowInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// GetInvitationById returns an invitation by id
+func (repository *PostgresRepository) GetInvitationById(ctx context.Context, id string) (*models.Invitation, error) {
+	q := `
+		SELECT ` + invitationFields + `
+		FROM invitations
+		WHERE id = $1;
+	`
+
+	invitations, err := repository.listInvitationByQuery(ctx, q, id)
+	if err != nil || len(invitations) == 0 {
+		return nil, err
+	}
+
+	return invitations[0], nil
+}
+
+// GetPendingInvitationByTokenHash returns the invitation of a token hash
+// when it is neither expired, accepted nor revoked
+func (repository *PostgresRepository) GetPendingInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	q := `
+		SELECT ` + invitationFields + `
+		FROM invitations
+		WHERE token_hash = $1 AND expires_at > $2
+			AND accepted_at IS NULL AND revoked_at IS NULL;
+	`
+
+	invitations, err := repository.listInvitationByQuery(ctx, q, tokenHash, time.Now())
+	if err != nil || len(invitations) == 0 {
+		return nil, err
+	}
+
+	return invitations[0], nil
+}
+
+// ListPendingInvitation returns the invitations neither accepted nor
+// revoked, the expired ones included
+func (repository *PostgresRepository) ListPendingInvitation(ctx context.Context) ([]*models.Invitation, error) {
+	q := `
+		SELECT ` + invitationFields + `
+		FROM invitations
+		WHERE accepted_at IS NULL AND revoked_at IS NULL
+		ORDER BY created_at DESC;
+	`
+
+	return repository.listInvitationByQuery(ctx, q)
+}
+
+// RevokeInvitation revokes a pending invitation
+func (repository *PostgresRepository) RevokeInvitation(ctx context.Context, id string) error {
+	q := `
+		UPDATE invitations
+		SET revoked_at = $1
+		WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation as accepted by a user and
+// reports whether it was still pending, so it is only accepted once
+func (repository *PostgresRepository) AcceptInvitation(ctx context.Context, id string, userId string) (bool, error) {
+	q := `
+		UPDATE invitations
+		SET accepted_at = $1, accepted_by = $2
+		WHERE id = $3 AND expires_at > $1
+			AND accepted_at IS NULL AND revoked_at IS NULL;
+	`
+
+	result, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), userId, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
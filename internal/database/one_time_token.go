@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// InsertOneTimeToken stores a token hash, revoking the unused tokens of the
+// same user and purpose
+func (repository *PostgresRepository) InsertOneTimeToken(ctx context.Context, token *models.OneTimeToken) error {
+	return repository.WithTx(ctx, func(ctx context.Context) error {
+		q := `
+			DELETE FROM one_time_tokens
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+		`
+
+		_, err := repository.conn(ctx).ExecContext(ctx, q, token.UserId, token.Purpose)
+		if err != nil {
+			return err
+		}
+
+		q = `
+			INSERT INTO one_time_tokens (
+				id, user_id, purpose, token_hash, expires_at, created_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+
+		_, err = repository.conn(ctx).ExecContext(
+			ctx, q,
+			token.Id, token.UserId, token.Purpose,
+			token.TokenHash, token.ExpiresAt, time.Now(),
+		)
+
+		return err
+	})
+}
+
+// GetOneTimeToken returns a valid token without using it, a token that is
+// unknown, expired or already used returns nil
+func (repository *PostgresRepository) GetOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	q := `
+		SELECT id, user_id, purpose, token_hash,
+			expires_at, used_at, created_at
+		FROM one_time_tokens
+		WHERE token_hash = $1 AND purpose = $2
+			AND used_at IS NULL AND expires_at > $3;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, tokenHash, purpose, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var token *models.OneTimeToken
+
+	for rows.Next() {
+		token, err = ScanRowOneTimeToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ConsumeOneTimeToken marks a valid token as used and returns it, a token
+// that is unknown, expired or already used returns nil
+func (repository *PostgresRepository) ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	q := `
+		UPDATE one_time_tokens
+		SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3
+			AND used_at IS NULL AND expires_at > $1
+		RETURNING id, user_id, purpose, token_hash,
+			expires_at, used_at, created_at;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, time.Now(), tokenHash, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var token *models.OneTimeToken
+
+	for rows.Next() {
+		token, err = ScanRowOneTimeToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// DeleteOneTimeTokens deletes the unused tokens of a user for a purpose
+func (repository *PostgresRepository) DeleteOneTimeTokens(ctx context.Context, userId string, purpose string) error {
+	q := `
+		DELETE FROM one_time_tokens
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, userId, purpose)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// organizationFields is the list of columns scanned by ScanRowOrganization
+const organizationFields = `id, name, slug, is_active, created_at, updated_at`
+
+// membershipFields is the list of columns scanned by ScanRowMembership
+const membershipFields = `organization_id, user_id, status, invited_by,
+			created_at, updated_at`
+
+// InsertOrganization inserts a new organization into the database
+func (repository *PostgresRepository) InsertOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error) {
+	q := `
+		INSERT INTO organizations (
+			id, name, slug, is_active, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING ` + organizationFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		organization.Id, organization.Name, organization.Slug,
+		organization.IsActive, time.Now(),
+	)
+
+	return ScanRowOrganization(row)
+}
+
+// getOrganizationByQuery returns an organization by executing the given query
+func (repository *PostgresRepository) getOrganizationByQuery(ctx context.Context, query string, args ...interface{}) (*models.Organization, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var organization *models.Organization
+
+	for rows.Next() {
+		organization, err = ScanRowOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+// GetOrganizationById returns an organization by id
+func (repository *PostgresRepository) GetOrganizationById(ctx context.Context, id string) (*models.Organization, error) {
+	q := `
+		SELECT ` + organizationFields + `
+		FROM organizations
+		WHERE id = $1;
+	`
+
+	return repository.getOrganizationByQuery(ctx, q, id)
+}
+
+// GetOrganizationBySlug returns an organization by slug
+func (repository *PostgresRepository) GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	q := `
+		SELECT ` + organizationFields + `
+		FROM organizations
+		WHERE slug = $1;
+	`
+
+	return repository.getOrganizationByQuery(ctx, q, slug)
+}
+
+// UpdateOrganization updates an organization in the database
+func (repository *PostgresRepository) UpdateOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error) {
+	q := `
+		UPDATE organizations
+		SET name = $1, slug = $2, is_active = $3, updated_at = $4
+		WHERE id = $5
+		RETURNING ` + organizationFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		organization.Name, organization.Slug, organization.IsActive,
+		time.Now(), organization.Id,
+	)
+
+	return ScanRowOrganization(row)
+}
+
+// InsertMembership inserts a new membership into the database
+func (repository *PostgresRepository) InsertMembership(ctx context.Context, membership *models.Membership) (*models.Membership, error) {
+	q := `
+		INSERT INTO memberships (
+			organization_id, user_id, status, invited_by,
+			created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING ` + membershipFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		membership.OrganizationId, membership.UserId, membership.Status,
+		nullString(membership.InvitedBy), time.Now(),
+	)
+
+	return ScanRowMembership(row)
+}
+
+// GetMembership returns the membership of a user in an organization with
+// the roles granted within it
+func (repository *PostgresRepository) GetMembership(ctx context.Context, organizationId string, userId string) (*models.Membership, error) {
+	q := `
+		SELECT ` + membershipFields + `
+		FROM memberships
+		WHERE organization_id = $1 AND user_id = $2;
+	`
+
+	memberships, err := repository.listMembershipByQuery(ctx, q, organizationId, userId)
+	if err != nil || len(memberships) == 0 {
+		return nil, err
+	}
+
+	return memberships[0], nil
+}
+
+// ListMembership returns the members of an organization
+func (repository *PostgresRepository) ListMembership(ctx context.Context, organizationId string) ([]*models.Membership, error) {
+	q := `
+		SELECT ` + membershipFields + `
+		FROM memberships
+		WHERE organization_id = $1
+		ORDER BY created_at;
+	`
+
+	return repository.listMembershipByQuery(ctx, q, organizationId)
+}
+
+// ListUserMembership returns the memberships of a user, invitations
+// included, with their organization
+func (repository *PostgresRepository) ListUserMembership(ctx context.Context, userId string) ([]*models.Membership, error) {
+	q := `
+		SELECT ` + membershipFields + `
+		FROM memberships
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`
+
+	memberships, err := repository.listMembershipByQuery(ctx, q, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range memberships {
+		m.Organization, err = repository.GetOrganizationById(ctx, m.OrganizationId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return memberships, nil
+}
+
+// UpdateMembershipStatus sets the status of a membership
+func (repository *PostgresRepository) UpdateMembershipStatus(ctx context.Context, organizationId string, userId string, status string) error {
+	q := `
+		UPDATE memberships
+		SET status = $1, updated_at = $2
+		WHERE organization_id = $3 AND user_id = $4;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, status, time.Now(), organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteMembership removes a user from an organization along with the
+// roles granted within it
+func (repository *PostgresRepository) DeleteMembership(ctx context.Context, organizationId string, userId string) error {
+	return repository.WithTx(ctx, func(ctx context.Context) error {
+		q := `
+			DELETE FROM user_roles
+			WHERE organization_id = $1 AND user_id = $2;
+		`
+
+		_, err := repository.conn(ctx).ExecContext(ctx, q, organizationId, userId)
+		if err != nil {
+			return err
+		}
+
+		q = `
+			DELETE FROM memberships
+			WHERE organization_id = $1 AND user_id = $2;
+		`
+
+		_, err = repository.conn(ctx).ExecContext(ctx, q, organizationId, userId)
+
+		return err
+	})
+}
+
+// CountMembersWithRole returns the number of active members of an
+// organization holding the role within it. Inside a transaction the
+// organization stays locked until it ends, so that concurrent removals of
+// its members are counted one after the other
+func (repository *PostgresRepository) CountMembersWithRole(ctx context.Context, organizationId string, roleName string) (int, error) {
+	q := `
+		SELECT id
+		FROM organizations
+		WHERE id = $1
+		FOR UPDATE;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, organizationId)
+	if err != nil {
+		return 0, err
+	}
+
+	q = `
+		SELECT COUNT(DISTINCT memberships.user_id)
+		FROM memberships
+		INNER JOIN user_roles
+		ON user_roles.organization_id = memberships.organization_id AND user_roles.user_id = memberships.user_id
+		INNER JOIN roles
+		ON roles.id = user_roles.role_id
+		WHERE memberships.organization_id = $1 AND memberships.status = $2 AND roles.name = $3;
+	`
+
+	var count int
+
+	err = repository.conn(ctx).QueryRowContext(ctx, q, organizationId, models.MembershipActive, roleName).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// listMembershipByQuery returns the memberships returned by the given
+// query, their roles are loaded with a single query per organization
+func (repository *PostgresRepository) listMembershipByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.Membership, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var memberships []*models.Membership
+
+	for rows.Next() {
+		membership, err := ScanRowMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		memberships = append(memberships, membership)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roles := map[string]map[string][]models.Role{}
+
+	for _, m := range memberships {
+		if _, ok := roles[m.OrganizationId]; !ok {
+			roles[m.OrganizationId], err = repository.listOrganizationRoles(ctx, m.OrganizationId)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		m.Roles = roles[m.OrganizationId][m.UserId]
+	}
+
+	return memberships, nil
+}
+
+// listOrganizationRoles returns the roles granted within an organization
+// by user id
+func (repository *PostgresRepository) listOrganizationRoles(ctx context.Context, organizationId string) (map[string][]models.Role, error) {
+	q := `
+		SELECT user_roles.user_id, roles.id, roles.name
+		FROM roles
+		INNER JOIN user_roles
+		ON roles.id = user_roles.role_id
+		WHERE user_roles.organization_id = $1
+		ORDER BY roles.name;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, organizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := map[string][]models.Role{}
+
+	for rows.Next() {
+		var userId string
+		var role models.Role
+
+		if err = rows.Scan(&userId, &role.Id, &role.Name); err != nil {
+			return nil, err
+		}
+
+		roles[userId] = append(roles[userId], role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// InsertOutboxEmail stores an email that could not be queued, to be
+// published by the outbox relay
+func (repository *PostgresRepository) InsertOutboxEmail(ctx context.Context, id string, message *models.EmailMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	q := `
+		INSERT INTO email_outbox (id, message, created_at)
+		VALUES ($1, $2, $3);
+	`
+
+	_, err = repository.conn(ctx).ExecContext(ctx, q, id, body, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimOutboxEmails returns the oldest stored emails and leases them, so
+// other relays skip them while they are being published
+func (repository *PostgresRepository) ClaimOutboxEmails(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEmail, error) {
+	q := `
+		UPDATE email_outbox
+		SET locked_until = $1
+		WHERE id IN (
+			SELECT id
+			FROM email_outbox
+			WHERE locked_until IS NULL OR locked_until <= $2
+			ORDER BY created_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, message, created_at;
+	`
+
+	now := time.Now()
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var emails []*models.OutboxEmail
+
+	for rows.Next() {
+		email, err := ScanRowOutboxEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The returned rows are not ordered
+	sort.Slice(emails, func(i, j int) bool {
+		if emails[i].CreatedAt.Equal(emails[j].CreatedAt) {
+			return emails[i].Id < emails[j].Id
+		}
+
+		return emails[i].CreatedAt.Before(emails[j].CreatedAt)
+	})
+
+	return emails, nil
+}
+
+// DeleteOutboxEmail drops an email that reached the broker, the rendered
+// message holds one time links that must not outlive its delivery
+func (repository *PostgresRepository) DeleteOutboxEmail(ctx context.Context, id string) error {
+	q := `
+		DELETE FROM email_outbox
+		WHERE id = $1;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkOutboxEmailFailed records a failed attempt to publish an email and
+// releases it for the next poll
+func (repository *PostgresRepository) MarkOutboxEmailFailed(ctx context.Context, id string, reason string) error {
+	q := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, last_error = $1, locked_until = NULL
+		WHERE id = $2;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, reason, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseOutboxEmails drops the lease of claimed emails left unpublished, so
+// that the next poll publishes them in order
+func (repository *PostgresRepository) ReleaseOutboxEmails(ctx context.Context, ids []string) error {
+	q := `
+		UPDATE email_outbox
+		SET locked_until = NULL
+		WHERE id = ANY($1);
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
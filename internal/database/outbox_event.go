@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// InsertOutboxEvent stores an event to be published by the outbox relay
+func (repository *PostgresRepository) InsertOutboxEvent(ctx context.Context, event *models.Event) error {
+	q := `
+		INSERT INTO outbox_events (
+			id, type, version, payload, occurred_at
+		)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err := repository.conn(ctx).ExecContext(
+		ctx, q,
+		event.Id, event.Type, event.Version,
+		[]byte(event.Payload), event.OccurredAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents returns the oldest unpublished events and leases them,
+// so other relays skip them while they are being published
+func (repository *PostgresRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.Event, error) {
+	q := `
+		UPDATE outbox_events
+		SET locked_until = $1
+		WHERE id IN (
+			SELECT id
+			FROM outbox_events
+			WHERE published_at IS NULL AND (locked_until IS NULL OR locked_until <= $2)
+			ORDER BY occurred_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, type, version, payload, occurred_at;
+	`
+
+	now := time.Now()
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []*models.Event
+
+	for rows.Next() {
+		event, err := ScanRowEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The returned rows are not ordered
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].OccurredAt.Equal(events[j].OccurredAt) {
+			return events[i].Id < events[j].Id
+		}
+
+		return events[i].OccurredAt.Before(events[j].OccurredAt)
+	})
+
+	return events, nil
+}
+
+// MarkOutboxEventPublished records that an event reached the broker
+func (repository *PostgresRepository) MarkOutboxEventPublished(ctx context.Context, id string) error {
+	q := `
+		UPDATE outbox_events
+		SET published_at = $1, attempts = attempts + 1, last_error = NULL, locked_until = NULL
+		WHERE id = $2;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed attempt to publish an event and
+// releases it for the next poll
+func (repository *PostgresRepository) MarkOutboxEventFailed(ctx context.Context, id string, reason string) error {
+	q := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $1, locked_until = NULL
+		WHERE id = $2;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, reason, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseOutboxEvents drops the lease of claimed events left unpublished, so
+// that the next poll publishes them in order
+func (repository *PostgresRepository) ReleaseOutboxEvents(ctx context.Context, ids []string) error {
+	q := `
+		UPDATE outbox_events
+		SET locked_until = NULL
+		WHERE id = ANY($1);
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
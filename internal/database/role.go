@@ -55,7 +55,7 @@ func (repository *PostgresRepository) InsertRole(ctx context.Context, role *mode
 		RETURNING id, name
 	`
 
-	rows := repository.db.QueryRowContext(ctx, q, role.Id, role.Name)
+	rows := repository.conn(ctx).QueryRowContext(ctx, q, role.Id, role.Name)
 
 	r, err := ScanRowRole(rows)
 	if err != nil {
@@ -74,7 +74,7 @@ func (repository *PostgresRepository) GetRoleByName(ctx context.Context, name st
 		WHERE name = $1
 	`
 
-	rows, err := repository.db.QueryContext(ctx, q, name)
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, name)
 
 	defer func() {
 		err = rows.Close()
@@ -109,7 +109,7 @@ func (repository *PostgresRepository) GetRoleById(ctx context.Context, id string
 		WHERE id = $1
 	`
 
-	rows, err := repository.db.QueryContext(ctx, q, id)
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, id)
 
 	defer func() {
 		err = rows.Close()
@@ -145,7 +145,7 @@ func (repository *PostgresRepository) UpdateRole(ctx context.Context, role *mode
 		RETURNING id, name
 	`
 
-	rows := repository.db.QueryRowContext(ctx, q, role.Name, role.Id)
+	rows := repository.conn(ctx).QueryRowContext(ctx, q, role.Name, role.Id)
 
 	r, err := ScanRowRole(rows)
 	if err != nil {
@@ -163,7 +163,7 @@ func (repository *PostgresRepository) DeleteRole(ctx context.Context, id string)
 		RETURNING id, name
 	`
 
-	row := repository.db.QueryRowContext(ctx, q, id)
+	row := repository.conn(ctx).QueryRowContext(ctx, q, id)
 
 	r, err := ScanRowRole(row)
 	if err != nil {
@@ -180,7 +180,7 @@ func (repository *PostgresRepository) ListRole(ctx context.Context) ([]*models.R
 		FROM roles
 	`
 
-	rows, err := repository.db.QueryContext(ctx, q)
+	rows, err := repository.conn(ctx).QueryContext(ctx, q)
 
 	defer func() {
 		err = rows.Close()
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// sessionFields is the list of columns scanned by ScanRowSession
+const sessionFields = `id, user_id, user_agent, ip, token_family,
+			organization_id, refresh_token_hash, refresh_token_expires_at,
+			created_at, last_seen_at, revoked_at`
+
+// InsertSession inserts a new session into the database
+func (repository *PostgresRepository) InsertSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	q := `
+		INSERT INTO sessions (
+			id, user_id, user_agent, ip, token_family,
+			organization_id, created_at, last_seen_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING ` + sessionFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		session.Id, session.UserId, session.UserAgent,
+		session.Ip, session.TokenFamily, nullString(session.OrganizationId),
+		time.Now(),
+	)
+
+	ss, err := ScanRowSession(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// getSessionByQuery returns a session by executing the given query
+func (repository *PostgresRepository) getSessionByQuery(ctx context.Context, query string, args ...interface{}) (*models.Session, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var session *models.Session
+
+	for rows.Next() {
+		session, err = ScanRowSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetSessionById returns a session by id
+func (repository *PostgresRepository) GetSessionById(ctx context.Context, id string) (*models.Session, error) {
+	q := `
+		SELECT ` + sessionFields + `
+		FROM sessions
+		WHERE id = $1;
+	`
+
+	return repository.getSessionByQuery(ctx, q, id)
+}
+
+// GetSessionByTokenFamily returns the session a refresh token family belongs to
+func (repository *PostgresRepository) GetSessionByTokenFamily(ctx context.Context, family string) (*models.Session, error) {
+	q := `
+		SELECT ` + sessionFields + `
+		FROM sessions
+		WHERE token_family = $1;
+	`
+
+	return repository.getSessionByQuery(ctx, q, family)
+}
+
+// RotateSessionRefreshToken replaces the refresh token hash of an active session
+func (repository *PostgresRepository) RotateSessionRefreshToken(ctx context.Context, id string, tokenHash string, expiresAt time.Time) error {
+	q := `
+		UPDATE sessions
+		SET refresh_token_hash = $1, refresh_token_expires_at = $2,
+			last_seen_at = $3
+		WHERE id = $4 AND revoked_at IS NULL;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, tokenHash, expiresAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetSessionOrganization sets the organization selected by an active
+// session, an empty organizationId clears it
+func (repository *PostgresRepository) SetSessionOrganization(ctx context.Context, id string, organizationId string) error {
+	q := `
+		UPDATE sessions
+		SET organization_id = $1
+		WHERE id = $2 AND revoked_at IS NULL;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, nullString(organizationId), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListSession returns the active sessions of a user
+func (repository *PostgresRepository) ListSession(ctx context.Context, userId string) ([]*models.Session, error) {
+	q := `
+		SELECT ` + sessionFields + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC;
+	`
+
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []*models.Session
+
+	for rows.Next() {
+		session, err := ScanRowSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// SessionTouchInterval is the precision of the last activity of a session,
+// it is written at most once per interval instead of on every request
+const SessionTouchInterval = time.Minute
+
+// TouchSession records activity on a session and reports whether it is
+// still active for the given user
+func (repository *PostgresRepository) TouchSession(ctx context.Context, id string, userId string) (bool, error) {
+	q := `
+		WITH session AS (
+			SELECT id, last_seen_at
+			FROM sessions
+			WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+		), touched AS (
+			UPDATE sessions
+			SET last_seen_at = $1
+			WHERE id IN (SELECT id FROM session WHERE last_seen_at < $4)
+		)
+		SELECT COUNT(*) FROM session;
+	`
+
+	now := time.Now()
+
+	var count int
+
+	err := repository.conn(ctx).QueryRowContext(ctx, q, now, id, userId, now.Add(-SessionTouchInterval)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// RevokeSession revokes a session
+func (repository *PostgresRepository) RevokeSession(ctx context.Context, id string) error {
+	q := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every session of a user except the given one,
+// an empty exceptId revokes them all
+func (repository *PostgresRepository) RevokeUserSessions(ctx context.Context, userId string, exceptId string) error {
+	q := `
+		UPDATE sessions
+		SET revoked_at = $1
+		WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, time.Now(), userId, exceptId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
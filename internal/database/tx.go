@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txKey is the context key of the transaction started by WithTx
+type txKey struct{}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction carried by the context, or the database
+func (repository *PostgresRepository) conn(ctx context.Context) queryer {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return repository.db
+}
+
+// WithTx runs fn in a transaction, every repository call made with the
+// context given to fn joins it. The transaction is committed when fn
+// returns nil and rolled back otherwise. Nested calls reuse the outer one
+func (repository *PostgresRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -2,36 +2,40 @@ package database
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/tapiaw38/auth-api/internal/models"
 )
 
+// userFields is the list of columns scanned by ScanRowUser
+const userFields = `id, first_name, last_name, username,
+			email, password, phone_number, picture, address,
+			is_active, verified_email, token_version,
+			locale, application_id, created_at, updated_at`
+
 // InsertUser inserts a new user into the database
 func (repository *PostgresRepository) InsertUser(ctx context.Context, user *models.User) (*models.User, error) {
 	q := `
 		INSERT INTO users (
 			id, first_name, last_name, username, email, 
 			password, phone_number, picture, address,
-			is_active, verified_email, 
+			is_active, verified_email, locale, application_id,
 			created_at, updated_at
 		) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING id, first_name, last_name, username, 
-			email, password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token,
-			verified_email_token_expiry, password_reset_token,
-			password_reset_token_expiry, created_at, updated_at;
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING ` + userFields + `;
 		`
-	row := repository.db.QueryRowContext(
+	row := repository.conn(ctx).QueryRowContext(
 		ctx, q,
 		user.Id, user.FirstName, user.LastName,
 		user.Username, user.Email, user.Password,
 		user.PhoneNumber, user.Picture, user.Address,
-		user.IsActive, user.VerifiedEmail,
+		user.IsActive, user.VerifiedEmail, user.Locale, nullString(user.ApplicationId),
 		time.Now(), time.Now(),
 	)
 
@@ -43,30 +47,49 @@ func (repository *PostgresRepository) InsertUser(ctx context.Context, user *mode
 	return u, nil
 }
 
-// updateUserRoles updates the roles of a user
-func (ur *PostgresRepository) updateUserRoles(ctx context.Context, u *models.User) error {
+// loadUserRoles sets the global roles of the given users with a single
+// query, the roles granted within an organization belong to the membership
+func (repository *PostgresRepository) loadUserRoles(ctx context.Context, users ...*models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(users))
+	byId := make(map[string]*models.User, len(users))
+
+	for _, u := range users {
+		u.Roles = nil
+		ids = append(ids, u.Id)
+		byId[u.Id] = u
+	}
+
 	q := `
-		SELECT roles.id, roles.name
+		SELECT user_roles.user_id, roles.id, roles.name
 		FROM roles
 		INNER JOIN user_roles
 		ON roles.id = user_roles.role_id
-		WHERE user_roles.user_id = $1;
+		WHERE user_roles.user_id = ANY($1) AND user_roles.organization_id IS NULL
+		ORDER BY roles.name;
 	`
 
-	rows, err := ur.db.QueryContext(ctx, q, u.Id)
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, pq.Array(ids))
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
-	u.Roles = nil // Limpiamos los roles actuales antes de actualizarlos
+	defer rows.Close()
 
 	for rows.Next() {
-		role, err := ScanRowRole(rows)
-		if err != nil {
+		var userId string
+		var role models.Role
+
+		if err = rows.Scan(&userId, &role.Id, &role.Name); err != nil {
 			return err
 		}
-		u.Roles = append(u.Roles, *role)
+
+		if u, ok := byId[userId]; ok {
+			u.Roles = append(u.Roles, role)
+		}
 	}
 
 	return rows.Err()
@@ -74,7 +97,7 @@ func (ur *PostgresRepository) updateUserRoles(ctx context.Context, u *models.Use
 
 // getUserByQuery returns a user by executing the given query
 func (repository *PostgresRepository) getUserByQuery(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
-	rows, err := repository.db.QueryContext(ctx, query, args...)
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,79 +111,95 @@ func (repository *PostgresRepository) getUserByQuery(ctx context.Context, query
 		if err != nil {
 			return nil, err
 		}
-
-		if err = repository.updateUserRoles(ctx, user); err != nil {
-			return nil, err
-		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
+	// The rows are closed first, a connection runs one query at a time
+	rows.Close()
+
+	if user == nil {
+		return nil, nil
+	}
+
+	if err = repository.loadUserRoles(ctx, user); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
 // GetUserById returns a user by id
 func (repository *PostgresRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, first_name, last_name, username, 
-			email, password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token,
-			verified_email_token_expiry, password_reset_token,
-			password_reset_token_expiry,
-			created_at, updated_at
-		FROM users 
+		SELECT ` + userFields + `
+		FROM users
 		WHERE id = $1;
 	`
 
 	return repository.getUserByQuery(ctx, query, id)
 }
 
-// GetUserByVerifiedEmailToken returns a user by verified email token
-func (repository *PostgresRepository) GetUserByVerifiedEmailToken(ctx context.Context, token string) (*models.User, error) {
+// GetUserByEmail returns a user by email
+func (repository *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, first_name, last_name, username, 
-			email, password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token,
-			verified_email_token_expiry, password_reset_token,
-			password_reset_token_expiry,
-			created_at, updated_at
-		FROM users 
-		WHERE verified_email_token = $1;
+		SELECT ` + userFields + `
+		FROM users
+		WHERE email = $1;
 	`
 
-	return repository.getUserByQuery(ctx, query, token)
+	return repository.getUserByQuery(ctx, query, email)
 }
 
-// GetUserByPasswordResetToken returns a user by password reset token
-func (repository *PostgresRepository) GetUserByPasswordResetToken(ctx context.Context, token string) (*models.User, error) {
+// GetUserByUsername returns a user by username
+func (repository *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, first_name, last_name, username, email, 
-			password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token, 
-			verified_email_token_expiry, password_reset_token, 
-			password_reset_token_expiry, created_at, updated_at
-		FROM users 
-		WHERE password_reset_token = $1;
+		SELECT ` + userFields + `
+		FROM users
+		WHERE username = $1;
 	`
 
-	return repository.getUserByQuery(ctx, query, token)
+	return repository.getUserByQuery(ctx, query, username)
 }
 
-// GetUserByEmail returns a user by email
-func (repository *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `
-		SELECT id, first_name, last_name, username, email, 
-			password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token, 
-			verified_email_token_expiry, password_reset_token, 
-			password_reset_token_expiry, created_at, updated_at
-		FROM users 
-		WHERE email = $1;
+// GetUserTokenVersion returns the current token version of a user
+func (repository *PostgresRepository) GetUserTokenVersion(ctx context.Context, id string) (int, error) {
+	q := `
+		SELECT token_version
+		FROM users
+		WHERE id = $1;
 	`
 
-	return repository.getUserByQuery(ctx, query, email)
+	var version int
+
+	err := repository.conn(ctx).QueryRowContext(ctx, q, id).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// IncrementTokenVersion bumps the token version of a user, invalidating
+// every token issued with a previous version
+func (repository *PostgresRepository) IncrementTokenVersion(ctx context.Context, id string) (int, error) {
+	q := `
+		UPDATE users
+		SET token_version = token_version + 1, updated_at = $1
+		WHERE id = $2
+		RETURNING token_version;
+	`
+
+	var version int
+
+	err := repository.conn(ctx).QueryRowContext(ctx, q, time.Now(), id).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
 }
 
 // UpdateUser updates a user in the database
@@ -171,24 +210,15 @@ func (ur *PostgresRepository) UpdateUser(ctx context.Context, id string, user *m
 			first_name = $1, last_name = $2, email = $3,
 			password = $4, picture = $5, phone_number = $6, 
 			address = $7, is_active = $8, verified_email = $9, 
-			verified_email_token = $10, verified_email_token_expiry = $11,
-			password_reset_token = $12, password_reset_token_expiry = $13,
-			updated_at = $14
-		WHERE id = $15
-		RETURNING id, first_name, last_name, username, 
-			email, password, phone_number, picture, address, 
-			is_active, verified_email, verified_email_token,
-			verified_email_token_expiry, password_reset_token,
-			password_reset_token_expiry,
-			created_at, updated_at;
+			updated_at = $10
+		WHERE id = $11
+		RETURNING ` + userFields + `;
 	`
 
-	row := ur.db.QueryRowContext(
+	row := ur.conn(ctx).QueryRowContext(
 		ctx, q, user.FirstName, user.LastName, user.Email,
 		user.Password, user.Picture, user.PhoneNumber, user.Address,
-		user.IsActive, user.VerifiedEmail, user.VerifiedEmailToken,
-		user.VerifiedEmailTokenExpiry, user.PasswordResetToken,
-		user.PasswordResetTokenExpiry,
+		user.IsActive, user.VerifiedEmail,
 		time.Now(), id,
 	)
 
@@ -197,22 +227,31 @@ func (ur *PostgresRepository) UpdateUser(ctx context.Context, id string, user *m
 		return nil, err
 	}
 
-	if err := ur.updateUserRoles(ctx, u); err != nil {
+	if err := ur.loadUserRoles(ctx, u); err != nil {
 		return nil, err
 	}
 
 	return u, nil
 }
 
-// PartialUpdateUser partially updates a user in the database
-func (ur *PostgresRepository) PartialUpdateUser(ctx context.Context, id string, updates map[string]interface{}) (*models.User, error) {
-	// Comienza una transacción
-	tx, err := ur.db.BeginTx(ctx, nil)
+// DeleteUser deletes a user, its sessions, tokens, roles and memberships
+// are deleted along with it
+func (repository *PostgresRepository) DeleteUser(ctx context.Context, id string) error {
+	q := `
+		DELETE FROM users
+		WHERE id = $1;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer tx.Rollback()
 
+	return nil
+}
+
+// PartialUpdateUser partially updates a user in the database
+func (ur *PostgresRepository) PartialUpdateUser(ctx context.Context, id string, updates map[string]interface{}) (*models.User, error) {
 	// Construye la consulta de actualización dinámicamente
 	updateFields := []string{}
 	values := []interface{}{}
@@ -236,79 +275,221 @@ func (ur *PostgresRepository) PartialUpdateUser(ctx context.Context, id string,
 		UPDATE users
 		SET ` + strings.Join(updateFields, ", ") + `
 		WHERE id = $` + strconv.Itoa(len(values)) + `
-		RETURNING id, first_name, last_name, username, email,
-			password, phone_number, picture, address,
-			is_active, verified_email, verified_email_token,
-			verified_email_token_expiry, password_reset_token,
-			password_reset_token_expiry,
-			created_at, updated_at
+		RETURNING ` + userFields + `
 	`
 
-	row := tx.QueryRowContext(ctx, q, values...)
+	var u *models.User
 
-	u, err := ScanRowUser(row)
+	// Comienza una transacción
+	err := ur.WithTx(ctx, func(ctx context.Context) error {
+		row := ur.conn(ctx).QueryRowContext(ctx, q, values...)
+
+		var err error
+		u, err = ScanRowUser(row)
+		if err != nil {
+			return err
+		}
+
+		return ur.loadUserRoles(ctx, u)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err := ur.updateUserRoles(ctx, u); err != nil {
-		return nil, err
+	return u, nil
+}
+
+// userSortColumns maps the sortable fields of a user to their column. The
+// nullable last name is coalesced so that every sort key can be compared
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"email":      "email",
+	"username":   "username",
+	"first_name": "first_name",
+	"last_name":  "COALESCE(last_name, '')",
+}
+
+// likePattern returns a pattern matching the given text anywhere, with the
+// wildcards of the text escaped
+func likePattern(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + replacer.Replace(text) + "%"
+}
+
+// ListUser returns the users matching the filter along with the total
+// number of matches regardless of the limit and cursor
+func (repository *PostgresRepository) ListUser(ctx context.Context, filter *models.UserFilter) ([]*models.User, int, error) {
+	conditions := []string{}
+	values := []interface{}{}
+
+	// next returns the placeholder of a new value
+	next := func(value interface{}) string {
+		values = append(values, value)
+		return "$" + strconv.Itoa(len(values))
 	}
 
-	// Commit la transacción
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	if filter.Search != "" {
+		placeholder := next(likePattern(filter.Search))
+		conditions = append(conditions, "(first_name ILIKE "+placeholder+
+			" OR last_name ILIKE "+placeholder+
+			" OR email ILIKE "+placeholder+
+			" OR username ILIKE "+placeholder+
+			" OR (first_name || ' ' || COALESCE(last_name, '')) ILIKE "+placeholder+")")
 	}
 
-	return u, nil
-}
+	if filter.Role != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1
+			FROM user_roles
+			INNER JOIN roles
+			ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = users.id
+			AND user_roles.organization_id IS NULL
+			AND roles.name = `+next(filter.Role)+`
+		)`)
+	}
 
-// GetUsers returns all users
-func (repository *PostgresRepository) ListUser(ctx context.Context, limit int, page int) ([]*models.User, error) {
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = "+next(*filter.IsActive))
+	}
+
+	if filter.VerifiedEmail != nil {
+		conditions = append(conditions, "verified_email = "+next(*filter.VerifiedEmail))
+	}
+
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+next(filter.CreatedFrom))
+	}
+
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < "+next(filter.CreatedTo))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	q := `
-	SELECT id, first_name, last_name, username, 
-		email, password, phone_number, picture, address, 
-		is_active, verified_email, verified_email_token,
-		verified_email_token_expiry, password_reset_token,
-		password_reset_token_expiry,
-		created_at, updated_at
-	FROM users
-	ORDER BY created_at DESC
-	LIMIT $1 OFFSET $2;
+		SELECT COUNT(*)
+		FROM users
+		` + where + `;
 	`
 
-	rows, err := repository.db.QueryContext(ctx, q, limit, (page-1)*limit)
+	var total int
 
-	defer func() {
-		err = rows.Close()
-		if err != nil {
-			log.Fatal(err)
+	err := repository.conn(ctx).QueryRowContext(ctx, q, values...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Only whitelisted columns reach the query, the id keeps the order stable
+	sorts := filter.Sort
+	if len(sorts) == 0 {
+		sorts = []models.UserSort{{Field: "created_at", Desc: true}}
+	}
+
+	type sortKey struct {
+		column string
+		desc   bool
+		value  string
+	}
+
+	keys := []sortKey{}
+	for _, sort := range sorts {
+		column, ok := userSortColumns[sort.Field]
+		if !ok {
+			return nil, 0, fmt.Errorf("unknown sort field %q", sort.Field)
 		}
-	}()
 
-	var users []*models.User
+		keys = append(keys, sortKey{column: column, desc: sort.Desc})
+	}
 
-	for rows.Next() {
+	keys = append(keys, sortKey{column: "id", desc: true})
 
-		user, err := ScanRowUser(rows)
-		if err != nil {
-			return nil, err
+	order := []string{}
+	for _, key := range keys {
+		if key.desc {
+			order = append(order, key.column+" DESC")
+		} else {
+			order = append(order, key.column)
+		}
+	}
+
+	// The rows after the cursor are the ones following it on the first
+	// differing sort key, compared with the values carried by the cursor so
+	// that a later change to its row does not move the page
+	if len(filter.Cursor) > 0 {
+		if len(filter.Cursor) != len(keys) {
+			return nil, 0, errors.New("the cursor does not match the sort")
+		}
+
+		for i := range keys {
+			keys[i].value = next(filter.Cursor[i])
+		}
+
+		after := []string{}
+		for i, key := range keys {
+			terms := []string{}
+			for _, previous := range keys[:i] {
+				terms = append(terms, previous.column+" = "+previous.value)
+			}
+
+			operator := " > "
+			if key.desc {
+				operator = " < "
+			}
+
+			terms = append(terms, key.column+operator+key.value)
+			after = append(after, "("+strings.Join(terms, " AND ")+")")
+		}
+
+		cursor := "(" + strings.Join(after, " OR ") + ")"
+		if where == "" {
+			where = "WHERE " + cursor
+		} else {
+			where += " AND " + cursor
 		}
+	}
+
+	q = `
+		SELECT ` + userFields + `
+		FROM users
+		` + where + `
+		ORDER BY ` + strings.Join(order, ", ") + `
+		LIMIT ` + next(filter.Limit) + `;
+	`
 
-		err = repository.updateUserRoles(ctx, user)
+	rows, err := repository.conn(ctx).QueryContext(ctx, q, values...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var users []*models.User
+
+	for rows.Next() {
+		user, err := ScanRowUser(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	rows.Close()
+
+	if err = repository.loadUserRoles(ctx, users...); err != nil {
+		return nil, 0, err
 	}
 
-	return users, nil
+	return users, total, nil
 }
 
 // Close closes the database connection
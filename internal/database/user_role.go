@@ -6,16 +6,18 @@ import (
 	"github.com/tapiaw38/auth-api/internal/models"
 )
 
-// InsertUserRole inserts a new user_role into the database
+// InsertUserRole inserts a new user_role into the database, a role already
+// granted is left as is
 func (repository *PostgresRepository) InsertUserRole(ctx context.Context, userRole *models.UserRole) error {
 
 	q := `
 		INSERT INTO user_roles (
-			user_id, role_id
-		) VALUES ($1, $2)
+			user_id, role_id, organization_id
+		) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
 	`
 
-	_, err := repository.db.ExecContext(ctx, q, userRole.UserId, userRole.RoleId)
+	_, err := repository.conn(ctx).ExecContext(ctx, q, userRole.UserId, userRole.RoleId, nullString(userRole.OrganizationId))
 	if err != nil {
 		return err
 	}
@@ -29,9 +31,10 @@ func (repository *PostgresRepository) DeleteUserRole(ctx context.Context, userRo
 	q := `
 		DELETE FROM user_roles
 		WHERE user_id = $1 AND role_id = $2
+			AND organization_id IS NOT DISTINCT FROM $3
 		`
 
-	_, err := repository.db.ExecContext(ctx, q, userRole.UserId, userRole.RoleId)
+	_, err := repository.conn(ctx).ExecContext(ctx, q, userRole.UserId, userRole.RoleId, nullString(userRole.OrganizationId))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// errRollback discards the rows seeded by a benchmark
+var errRollback = errors.New("rollback")
+
+// BenchmarkLoadUserRoles compares loading the roles of a page of users one
+// query per user against the single batched query. It needs a migrated
+// database at DATABASE_URL and is skipped otherwise
+func BenchmarkLoadUserRoles(b *testing.B) {
+	repository, err := NewPostresRepository(DATABASE_URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer repository.Close()
+
+	if err = repository.db.PingContext(context.Background()); err != nil {
+		b.Skip("database not available: ", err)
+	}
+
+	err = repository.WithTx(context.Background(), func(ctx context.Context) error {
+		role, err := repository.InsertRole(ctx, &models.Role{
+			Id:   ksuid.New().String(),
+			Name: "bench-" + ksuid.New().String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		users := make([]*models.User, 0, 100)
+
+		for i := 0; i < 100; i++ {
+			id := ksuid.New().String()
+
+			u, err := repository.InsertUser(ctx, &models.User{
+				Id:        id,
+				FirstName: "Bench",
+				Username:  "bench-" + id,
+				Email:     "bench-" + id + "@example.com",
+				IsActive:  true,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = repository.InsertUserRole(ctx, &models.UserRole{UserId: u.Id, RoleId: role.Id})
+			if err != nil {
+				return err
+			}
+
+			users = append(users, u)
+		}
+
+		b.Run("per user", func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for _, u := range users {
+					if err := repository.loadUserRoles(ctx, u); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run("batched", func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := repository.loadUserRoles(ctx, users...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		return errRollback
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		b.Fatal(err)
+	}
+}
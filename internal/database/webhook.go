@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// webhookFields is the list of columns scanned by ScanRowWebhook
+const webhookFields = `id, url, secret, event_types, is_active,
+			created_at, updated_at`
+
+// webhookDeliveryFields is the list of columns scanned by ScanRowWebhookDelivery
+const webhookDeliveryFields = `id, webhook_id, event_id, event_type, payload,
+			status, attempts, next_attempt_at, last_status_code, last_error,
+			delivered_at, created_at, updated_at`
+
+// InsertWebhook inserts a new webhook into the database
+func (repository *PostgresRepository) InsertWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	q := `
+		INSERT INTO webhooks (
+			id, url, secret, event_types, is_active,
+			created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		RETURNING ` + webhookFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		webhook.Id, webhook.Url, webhook.Secret,
+		pq.Array(webhook.EventTypes), webhook.IsActive, time.Now(),
+	)
+
+	return ScanRowWebhook(row)
+}
+
+// listWebhookByQuery returns the webhooks returned by the given query
+func (repository *PostgresRepository) listWebhookByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.Webhook, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+
+	for rows.Next() {
+		webhook, err := ScanRowWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookById returns a webhook by id
+func (repository *PostgresRepository) GetWebhookById(ctx context.Context, id string) (*models.Webhook, error) {
+	q := `
+		SELECT ` + webhookFields + `
+		FROM webhooks
+		WHERE id = $1;
+	`
+
+	webhooks, err := repository.listWebhookByQuery(ctx, q, id)
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+
+	return webhooks[0], nil
+}
+
+// ListWebhook returns all webhooks
+func (repository *PostgresRepository) ListWebhook(ctx context.Context) ([]*models.Webhook, error) {
+	q := `
+		SELECT ` + webhookFields + `
+		FROM webhooks
+		ORDER BY created_at;
+	`
+
+	return repository.listWebhookByQuery(ctx, q)
+}
+
+// ListWebhookByEventType returns the active webhooks subscribed to an event type
+func (repository *PostgresRepository) ListWebhookByEventType(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	q := `
+		SELECT ` + webhookFields + `
+		FROM webhooks
+		WHERE is_active AND $1 = ANY(event_types);
+	`
+
+	return repository.listWebhookByQuery(ctx, q, eventType)
+}
+
+// UpdateWebhook updates a webhook in the database
+func (repository *PostgresRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	q := `
+		UPDATE webhooks
+		SET url = $1, secret = $2, event_types = $3, is_active = $4,
+			updated_at = $5
+		WHERE id = $6
+		RETURNING ` + webhookFields + `;
+	`
+
+	row := repository.conn(ctx).QueryRowContext(
+		ctx, q,
+		webhook.Url, webhook.Secret, pq.Array(webhook.EventTypes),
+		webhook.IsActive, time.Now(), webhook.Id,
+	)
+
+	return ScanRowWebhook(row)
+}
+
+// DeleteWebhook deletes a webhook and its delivery history
+func (repository *PostgresRepository) DeleteWebhook(ctx context.Context, id string) error {
+	q := `
+		DELETE FROM webhooks
+		WHERE id = $1;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertWebhookDelivery queues a delivery of an event to a webhook
+func (repository *PostgresRepository) InsertWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	q := `
+		INSERT INTO webhook_deliveries (
+			id, webhook_id, event_id, event_type, payload,
+			status, next_attempt_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $7);
+	`
+
+	_, err := repository.conn(ctx).ExecContext(
+		ctx, q,
+		delivery.Id, delivery.WebhookId, delivery.EventId, delivery.EventType,
+		[]byte(delivery.Payload), models.WebhookDeliveryPending, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// listWebhookDeliveryByQuery returns the deliveries returned by the given query
+func (repository *PostgresRepository) listWebhookDeliveryByQuery(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	rows, err := repository.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+
+	for rows.Next() {
+		delivery, err := ScanRowWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhookDeliveryById returns a delivery by id
+func (repository *PostgresRepository) GetWebhookDeliveryById(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	q := `
+		SELECT ` + webhookDeliveryFields + `
+		FROM webhook_deliveries
+		WHERE id = $1;
+	`
+
+	deliveries, err := repository.listWebhookDeliveryByQuery(ctx, q, id)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	return deliveries[0], nil
+}
+
+// ListWebhookDelivery returns the latest deliveries of a webhook
+func (repository *PostgresRepository) ListWebhookDelivery(ctx context.Context, webhookId string, limit int) ([]*models.WebhookDelivery, error) {
+	q := `
+		SELECT ` + webhookDeliveryFields + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2;
+	`
+
+	return repository.listWebhookDeliveryByQuery(ctx, q, webhookId, limit)
+}
+
+// ClaimWebhookDeliveries returns the pending deliveries that are due and
+// postpones them by the lease, so other workers skip them while they are
+// being sent
+func (repository *PostgresRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	q := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryFields + `;
+	`
+
+	now := time.Now()
+
+	return repository.listWebhookDeliveryByQuery(ctx, q, now.Add(lease), models.WebhookDeliveryPending, now, limit)
+}
+
+// UpdateWebhookDelivery records the result of a delivery attempt
+func (repository *PostgresRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	q := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3,
+			last_status_code = $4, last_error = $5, delivered_at = $6,
+			updated_at = $7
+		WHERE id = $8;
+	`
+
+	_, err := repository.conn(ctx).ExecContext(
+		ctx, q,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+		nullInt(delivery.LastStatusCode), nullString(delivery.LastError),
+		delivery.DeliveredAt, time.Now(), delivery.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
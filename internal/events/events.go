@@ -0,0 +1,90 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/rabbitmq"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/webhooks"
+)
+
+// New creates the envelope of a domain event
+func New(eventType string, payload interface{}) (*models.Event, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Event{
+		Id:         id.String(),
+		Type:       eventType,
+		Version:    models.EventVersion,
+		OccurredAt: time.Now(),
+		Payload:    body,
+	}, nil
+}
+
+// Publish stores a domain event in the outbox and queues its webhook
+// deliveries. Called inside repository.WithTx the event is only kept if
+// the transaction commits, the relay then delivers it to RabbitMQ
+func Publish(ctx context.Context, eventType string, payload interface{}) error {
+	event, err := New(eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	err = repository.InsertOutboxEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return webhooks.Enqueue(ctx, event)
+}
+
+// NewUserPayload returns the event payload of a user
+func NewUserPayload(user *models.User) *models.UserEventPayload {
+	roles := []string{}
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	return &models.UserEventPayload{
+		Id:            user.Id,
+		Email:         user.Email,
+		Username:      user.Username,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		IsActive:      user.IsActive,
+		VerifiedEmail: user.VerifiedEmail,
+		Roles:         roles,
+	}
+}
+
+// QueueEmail publishes an email message, storing it in the outbox when
+// RabbitMQ is unreachable so the caller does not fail. The relay then
+// publishes it once the broker is back
+func QueueEmail(ctx context.Context, conn *rabbitmq.RabbitMQConnection, message *models.EmailMessage) error {
+	err := conn.PublishEmail(message)
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("failed to publish email, storing it in the outbox: %s", err)
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	return repository.InsertOutboxEmail(ctx, id.String(), message)
+}
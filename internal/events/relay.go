@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/rabbitmq"
+	"github.com/tapiaw38/auth-api/internal/repository"
+)
+
+const (
+	// RelayBatchSize is the maximum number of events published per poll
+	RelayBatchSize = 100
+	// RelayLease outlives a full batch of timed out publishes
+	RelayLease = RelayBatchSize * rabbitmq.ConfirmTimeout
+)
+
+// Relay publishes the pending outbox events, and the emails stored while
+// RabbitMQ was unreachable, every interval until the context is done. They
+// are published in order, a failure stops the batch and the row is retried
+// on the next poll
+func Relay(ctx context.Context, conn *rabbitmq.RabbitMQConnection, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := relayEvents(ctx, conn); err != nil {
+				log.Printf("outbox relay: %s", err)
+			}
+
+			if err := relayEmails(ctx, conn); err != nil {
+				log.Printf("outbox relay: %s", err)
+			}
+		}
+	}
+}
+
+// relayEvents publishes one batch of pending events. The events are
+// claimed with a lease, no transaction is held open while publishing
+func relayEvents(ctx context.Context, conn *rabbitmq.RabbitMQConnection) error {
+	events, err := repository.ClaimOutboxEvents(ctx, RelayBatchSize, RelayLease)
+	if err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		err = conn.PublishEvent(event)
+		if err != nil {
+			log.Printf("outbox relay: failed to publish event %s: %s", event.Id, err)
+
+			ids := []string{}
+			for _, e := range events[i+1:] {
+				ids = append(ids, e.Id)
+			}
+
+			if err := repository.ReleaseOutboxEvents(ctx, ids); err != nil {
+				return err
+			}
+
+			return repository.MarkOutboxEventFailed(ctx, event.Id, err.Error())
+		}
+
+		err = repository.MarkOutboxEventPublished(ctx, event.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relayEmails publishes one batch of pending emails, claimed with a lease
+// like the events
+func relayEmails(ctx context.Context, conn *rabbitmq.RabbitMQConnection) error {
+	emails, err := repository.ClaimOutboxEmails(ctx, RelayBatchSize, RelayLease)
+	if err != nil {
+		return err
+	}
+
+	for i, email := range emails {
+		err = conn.PublishEmail(&email.Message)
+		if err != nil {
+			log.Printf("outbox relay: failed to publish email %s: %s", email.Id, err)
+
+			ids := []string{}
+			for _, e := range emails[i+1:] {
+				ids = append(ids, e.Id)
+			}
+
+			if err := repository.ReleaseOutboxEmails(ctx, ids); err != nil {
+				return err
+			}
+
+			return repository.MarkOutboxEmailFailed(ctx, email.Id, err.Error())
+		}
+
+		err = repository.DeleteOutboxEmail(ctx, email.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
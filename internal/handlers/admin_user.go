@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/events"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+// AdminUserUpdateRequest holds the fields an admin may change, only the
+// given ones are written
+type AdminUserUpdateRequest struct {
+	FirstName     *string `json:"first_name"`
+	LastName      *string `json:"last_name"`
+	Username      *string `json:"username"`
+	Email         *string `json:"email"`
+	PhoneNumber   *string `json:"phone_number"`
+	Picture       *string `json:"picture"`
+	Address       *string `json:"address"`
+	Locale        *string `json:"locale"`
+	ApplicationId *string `json:"application_id"`
+	VerifiedEmail *bool   `json:"verified_email"`
+	IsActive      *bool   `json:"is_active"`
+}
+
+// adminTargetUser returns the user of the request path, aborting the
+// request when it is missing, is the caller, or is a superadmin managed by
+// a mere admin
+func adminTargetUser(c *gin.Context) (*models.User, bool) {
+	user, err := repository.GetUserById(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if user == nil {
+		HandleError(c, http.StatusNotFound, errors.New("user not found"))
+		return nil, false
+	}
+
+	value, _ := c.Get(middleware.ClaimsKey)
+	claims, _ := value.(*models.AppClaims)
+
+	if claims == nil || claims.UserId == user.Id {
+		HandleError(c, http.StatusBadRequest, errors.New("use the self service endpoints for your own account"))
+		return nil, false
+	}
+
+	if user.HasRole("superadmin") {
+		caller, err := repository.GetUserById(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return nil, false
+		}
+
+		if caller == nil || !caller.HasRole("superadmin") {
+			HandleError(c, http.StatusForbidden, errors.New("forbidden"))
+			return nil, false
+		}
+	}
+
+	return user, true
+}
+
+// revokeUserAccess invalidates every token and session of a user at once
+func revokeUserAccess(ctx context.Context, userId string) error {
+	_, err := repository.IncrementTokenVersion(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	return repository.RevokeUserSessions(ctx, userId, "")
+}
+
+// setUserActive activates or deactivates a user, a deactivated user loses
+// its tokens and sessions immediately
+func setUserActive(ctx context.Context, userId string, active bool) (*models.User, error) {
+	var u *models.User
+
+	err := repository.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = UpdateUser(ctx, userId, map[string]interface{}{
+			"is_active":  active,
+			"updated_at": time.Now(),
+		}, models.EventUserUpdated)
+		if err != nil || active {
+			return err
+		}
+
+		return revokeUserAccess(ctx, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// AdminGetUserHandler handles the request of an admin to get a user
+func AdminGetUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repository.GetUserById(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user == nil {
+			HandleError(c, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
+	}
+}
+
+// AdminUpdateUserHandler handles the request of an admin to update any
+// field of a user. The email is written at once, without confirmation
+func AdminUpdateUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = AdminUserUpdateRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		user, ok := adminTargetUser(c)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		fields := []string{}
+
+		set := func(field string, value interface{}) {
+			updates[field] = value
+			fields = append(fields, field)
+		}
+
+		if request.FirstName != nil {
+			set("first_name", *request.FirstName)
+		}
+
+		if request.LastName != nil {
+			set("last_name", *request.LastName)
+		}
+
+		if request.PhoneNumber != nil {
+			set("phone_number", *request.PhoneNumber)
+		}
+
+		if request.Picture != nil {
+			set("picture", *request.Picture)
+		}
+
+		if request.Address != nil {
+			set("address", *request.Address)
+		}
+
+		if request.VerifiedEmail != nil {
+			set("verified_email", *request.VerifiedEmail)
+		}
+
+		if request.Username != nil && *request.Username != user.Username {
+			taken, err := repository.GetUserByUsername(c.Request.Context(), *request.Username)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if *request.Username == "" || taken != nil {
+				HandleError(c, http.StatusConflict, errors.New("username not available"))
+				return
+			}
+
+			set("username", *request.Username)
+		}
+
+		if request.Email != nil && !strings.EqualFold(*request.Email, user.Email) {
+			if !utils.ValidateEmail(*request.Email) {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid email"))
+				return
+			}
+
+			existing, err := repository.GetUserByEmail(c.Request.Context(), *request.Email)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if existing != nil {
+				HandleError(c, http.StatusConflict, errors.New("email already in use"))
+				return
+			}
+
+			set("email", *request.Email)
+		}
+
+		if request.Locale != nil {
+			locale := mailer.SupportedLocale(*request.Locale)
+			if locale == "" {
+				HandleError(c, http.StatusBadRequest, errors.New("unsupported locale"))
+				return
+			}
+
+			set("locale", locale)
+		}
+
+		if request.ApplicationId != nil {
+			if *request.ApplicationId != "" {
+				application, err := repository.GetApplicationById(c.Request.Context(), *request.ApplicationId)
+				if err != nil {
+					HandleError(c, http.StatusInternalServerError, err)
+					return
+				}
+
+				if application == nil {
+					HandleError(c, http.StatusBadRequest, ErrUnknownApplication)
+					return
+				}
+
+				set("application_id", *request.ApplicationId)
+			} else {
+				// A nil value would be skipped, the column is cleared with a NULL
+				set("application_id", sql.NullString{})
+			}
+		}
+
+		deactivate := request.IsActive != nil && !*request.IsActive && user.IsActive
+		if request.IsActive != nil {
+			set("is_active", *request.IsActive)
+		}
+
+		if len(fields) == 0 {
+			HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
+			return
+		}
+
+		updates["updated_at"] = time.Now()
+
+		var u *models.User
+
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			u, err = UpdateUser(ctx, user.Id, updates, models.EventUserUpdated)
+			if err != nil || !deactivate {
+				return err
+			}
+
+			return revokeUserAccess(ctx, user.Id)
+		})
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionUserUpdate, models.AuditOutcomeSuccess, "", u.Id, map[string]interface{}{
+			"fields": fields,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(u))
+	}
+}
+
+// AdminActivateUserHandler handles the request of an admin to reactivate
+// a user
+func AdminActivateUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := adminTargetUser(c)
+		if !ok {
+			return
+		}
+
+		u, err := setUserActive(c.Request.Context(), user.Id, true)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionUserActivate, models.AuditOutcomeSuccess, "", u.Id, nil)
+
+		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(u))
+	}
+}
+
+// AdminDeactivateUserHandler handles the request of an admin to deactivate
+// a user. Its tokens stop working at once and it can no longer log in
+func AdminDeactivateUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := adminTargetUser(c)
+		if !ok {
+			return
+		}
+
+		u, err := setUserActive(c.Request.Context(), user.Id, false)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionUserDeactivate, models.AuditOutcomeSuccess, "", u.Id, nil)
+
+		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(u))
+	}
+}
+
+// AdminForcePasswordResetHandler handles the request of an admin to force
+// a user to choose a new password. The current password stops working, the
+// sessions are revoked and a reset link is sent to the user
+func AdminForcePasswordResetHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := adminTargetUser(c)
+		if !ok {
+			return
+		}
+
+		var token string
+
+		err := repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			_, err := repository.PartialUpdateUser(ctx, user.Id, map[string]interface{}{
+				"password":   "",
+				"updated_at": time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = revokeUserAccess(ctx, user.Id); err != nil {
+				return err
+			}
+
+			token, err = IssueOneTimeToken(ctx, user.Id, models.TokenPurposeResetPassword, ResetPasswordTokenTTL)
+
+			return err
+		})
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		err = SendResetPasswordEmail(s, user, token)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionPasswordResetForce, models.AuditOutcomeSuccess, "", user.Id, nil)
+
+		HandleSuccess(c, http.StatusOK, "a password reset link has been sent to the user", nil)
+	}
+}
+
+// AdminDeleteUserHandler handles the request of an admin to delete a user
+// and everything attached to it for good
+func AdminDeleteUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := adminTargetUser(c)
+		if !ok {
+			return
+		}
+
+		err := repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			err := repository.DeleteUser(ctx, user.Id)
+			if err != nil {
+				return err
+			}
+
+			return events.Publish(ctx, models.EventUserDeleted, events.NewUserPayload(user))
+		})
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionUserDelete, models.AuditOutcomeSuccess, "", user.Id, map[string]interface{}{
+			"email": user.Email,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
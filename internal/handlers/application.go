@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+type ApplicationRequest struct {
+	Name          string  `json:"name"`
+	FrontendURL   string  `json:"frontend_url"`
+	SenderName    string  `json:"sender_name"`
+	SenderAddress string  `json:"sender_address"`
+	LogoURL       string  `json:"logo_url"`
+	TemplateSet   *string `json:"template_set"`
+	IsActive      *bool   `json:"is_active"`
+}
+
+// validateApplication checks the urls, sender and template set of an application
+func validateApplication(application *models.Application) error {
+	if application.Name == "" {
+		return errors.New("name is required")
+	}
+
+	u, err := url.Parse(application.FrontendURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid frontend url")
+	}
+
+	if application.LogoURL != "" {
+		u, err = url.Parse(application.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("invalid logo url")
+		}
+	}
+
+	if application.SenderName == "" || !utils.ValidateEmail(application.SenderAddress) {
+		return errors.New("invalid sender")
+	}
+
+	if !templateSetRegexp.MatchString(application.TemplateSet) {
+		return errors.New("invalid template set")
+	}
+
+	return nil
+}
+
+// InsertApplicationHandler handles the insert application request
+func InsertApplicationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = ApplicationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		application := models.Application{
+			Id:            id.String(),
+			Name:          request.Name,
+			FrontendURL:   request.FrontendURL,
+			SenderName:    request.SenderName,
+			SenderAddress: request.SenderAddress,
+			LogoURL:       request.LogoURL,
+			IsActive:      request.IsActive == nil || *request.IsActive,
+		}
+
+		if request.TemplateSet != nil {
+			application.TemplateSet = *request.TemplateSet
+		}
+
+		if err = validateApplication(&application); err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		app, err := repository.InsertApplication(c.Request.Context(), &application)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionApplicationCreate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"application_id": app.Id,
+			"name":           app.Name,
+		})
+
+		HandleSuccess(c, http.StatusCreated, "ok", app)
+	}
+}
+
+// ListApplicationHandler handles the list application request
+func ListApplicationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		applications, err := repository.ListApplication(c.Request.Context())
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if applications == nil {
+			applications = []*models.Application{}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", applications)
+	}
+}
+
+// GetApplicationByIdHandler handles the get application by id request
+func GetApplicationByIdHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		application, err := repository.GetApplicationById(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if application == nil {
+			HandleError(c, http.StatusNotFound, errors.New("application not found"))
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", application)
+	}
+}
+
+// UpdateApplicationHandler handles the update application request, only
+// the given fields are changed
+func UpdateApplicationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = ApplicationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		application, err := repository.GetApplicationById(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if application == nil {
+			HandleError(c, http.StatusNotFound, errors.New("application not found"))
+			return
+		}
+
+		if request.Name != "" {
+			application.Name = request.Name
+		}
+
+		if request.FrontendURL != "" {
+			application.FrontendURL = request.FrontendURL
+		}
+
+		if request.SenderName != "" {
+			application.SenderName = request.SenderName
+		}
+
+		if request.SenderAddress != "" {
+			application.SenderAddress = request.SenderAddress
+		}
+
+		if request.LogoURL != "" {
+			application.LogoURL = request.LogoURL
+		}
+
+		if request.TemplateSet != nil {
+			application.TemplateSet = *request.TemplateSet
+		}
+
+		if request.IsActive != nil {
+			application.IsActive = *request.IsActive
+		}
+
+		if err = validateApplication(application); err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		app, err := repository.UpdateApplication(c.Request.Context(), application)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionApplicationUpdate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"application_id": app.Id,
+			"name":           app.Name,
+			"is_active":      app.IsActive,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", app)
+	}
+}
+
+// DeleteApplicationHandler handles the delete application request, the
+// users of the application fall back to the default branding
+func DeleteApplicationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		application, err := repository.GetApplicationById(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if application == nil {
+			HandleError(c, http.StatusNotFound, errors.New("application not found"))
+			return
+		}
+
+		err = repository.DeleteApplication(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionApplicationDelete, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"application_id": id,
+			"name":           application.Name,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
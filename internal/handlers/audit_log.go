@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+// Page sizes of the audit log listing
+const (
+	DefaultAuditLogLimit = 50
+	MaxAuditLogLimit     = 200
+)
+
+type ListAuditLogResponse struct {
+	AuditLogs  []*models.AuditLog `json:"audit_logs"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// RecordAudit appends an event about the current request to the audit log.
+// The actor defaults to the authenticated user. A failure is only logged,
+// the audit log must not break the request it describes
+func RecordAudit(c *gin.Context, action string, outcome string, actorId string, targetId string, metadata map[string]interface{}) {
+	if actorId == "" {
+		if value, ok := c.Get(middleware.ClaimsKey); ok {
+			if claims, ok := value.(*models.AppClaims); ok {
+				actorId = claims.UserId
+			}
+		}
+	}
+
+	recordAudit(c.Request.Context(), c.ClientIP(), c.Request.UserAgent(), action, outcome, actorId, targetId, metadata)
+}
+
+// recordAudit appends an event to the audit log outside of a request, on
+// behalf of the client of the given ip and user agent
+func recordAudit(ctx context.Context, ip string, userAgent string, action string, outcome string, actorId string, targetId string, metadata map[string]interface{}) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	auditLog := models.AuditLog{
+		Id:        id.String(),
+		ActorId:   actorId,
+		TargetId:  targetId,
+		Action:    action,
+		Outcome:   outcome,
+		Ip:        ip,
+		UserAgent: userAgent,
+		Metadata:  metadata,
+	}
+
+	err = repository.InsertAuditLog(ctx, &auditLog)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// ListAuditLogHandler handles the list audit log request. Results can be
+// filtered by user_id, action and a from/to RFC 3339 time range, and are
+// paginated with the next_cursor of the previous page
+func ListAuditLogHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := models.AuditLogFilter{
+			UserId: c.Query("user_id"),
+			Action: c.Query("action"),
+		}
+
+		var err error
+
+		if from := c.Query("from"); from != "" {
+			filter.From, err = time.Parse(time.RFC3339, from)
+			if err != nil {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid from"))
+				return
+			}
+		}
+
+		if to := c.Query("to"); to != "" {
+			filter.To, err = time.Parse(time.RFC3339, to)
+			if err != nil {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid to"))
+				return
+			}
+		}
+
+		filter.Limit, filter.CursorCreatedAt, filter.CursorId, err = ParsePage(c, DefaultAuditLogLimit, MaxAuditLogLimit)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// One extra row tells whether there is a next page
+		limit := filter.Limit
+		filter.Limit++
+
+		auditLogs, err := repository.ListAuditLog(c.Request.Context(), &filter)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := ListAuditLogResponse{AuditLogs: auditLogs}
+		if len(auditLogs) > limit {
+			response.AuditLogs = auditLogs[:limit]
+			last := response.AuditLogs[limit-1]
+			response.NextCursor = utils.EncodeCursor(last.CreatedAt, last.Id)
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", response)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+// SetAuthCookies stores the access and refresh tokens in HttpOnly cookies,
+// along with a readable CSRF token the client must echo in a header
+func SetAuthCookies(c *gin.Context, s server.Server, accessToken string, refreshToken string) error {
+	csrfToken, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	setCookie(c, s, middleware.AccessTokenCookie, accessToken, "/", int(AccessTokenTTL.Seconds()), true)
+	setCookie(c, s, middleware.RefreshTokenCookie, refreshToken, "/auth/", int(RefreshTokenTTL.Seconds()), true)
+	setCookie(c, s, middleware.CSRFTokenCookie, csrfToken, "/", int(RefreshTokenTTL.Seconds()), false)
+
+	return nil
+}
+
+// ClearAuthCookies removes the cookies set by SetAuthCookies
+func ClearAuthCookies(c *gin.Context, s server.Server) {
+	setCookie(c, s, middleware.AccessTokenCookie, "", "/", -1, true)
+	setCookie(c, s, middleware.RefreshTokenCookie, "", "/auth/", -1, true)
+	setCookie(c, s, middleware.CSRFTokenCookie, "", "/", -1, false)
+}
+
+// setCookie writes a cookie using the cookie settings of the configuration
+func setCookie(c *gin.Context, s server.Server, name string, value string, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.Config().CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.Config().CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: sameSiteMode(s.Config().CookieSameSite),
+	})
+}
+
+// sameSiteMode converts the configured SameSite value
+func sameSiteMode(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/server"
+)
+
+type RequeueDeadLetterEmailRequest struct {
+	MessageIds []string `json:"message_ids"`
+}
+
+// Page sizes of the dead letter listing
+const (
+	DefaultDeadLetterEmailLimit = 50
+	MaxDeadLetterEmailLimit     = 500
+)
+
+// ListDeadLetterEmailHandler handles the inspection of the emails that could not be sent
+func ListDeadLetterEmailHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := DefaultDeadLetterEmailLimit
+
+		if value := c.Query("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > MaxDeadLetterEmailLimit {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid limit"))
+				return
+			}
+		}
+
+		deadLetters, err := s.Rabbit().Connection().ListDeadLetterEmail(limit)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", deadLetters)
+	}
+}
+
+// RequeueDeadLetterEmailHandler handles the request to send dead letters
+// again, all of them when no message id is given
+func RequeueDeadLetterEmailHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = RequeueDeadLetterEmailRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		requeued, err := s.Rabbit().Connection().RequeueDeadLetterEmail(request.MessageIds)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionEmailRequeue, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"message_ids": request.MessageIds,
+			"requeued":    requeued,
+		})
+
+		data := map[string]interface{}{
+			"requeued": requeued,
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", data)
+	}
+}
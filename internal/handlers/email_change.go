@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+)
+
+// ErrEmailInUse is returned when an email change targets the address of
+// another account
+var ErrEmailInUse = errors.New("email already in use")
+
+// ConfirmEmailChangeHandler handles the confirmation link sent to the new address.
+// The cancel link sent to the old address stays valid to revert the change
+func ConfirmEmailChangeHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("token is required"))
+			return
+		}
+
+		// The token is only used once the change can be applied
+		oneTimeToken, err := LookupOneTimeToken(c.Request.Context(), models.TokenPurposeEmailChangeConfirm, token)
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		emailChange, err := repository.GetEmailChangeByUserId(c.Request.Context(), oneTimeToken.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if emailChange == nil || !emailChange.ConfirmedAt.IsZero() || time.Now().After(emailChange.ExpiresAt) {
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		// A conflict rolls the transaction back, the token stays usable
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			existing, err := repository.GetUserByEmail(ctx, emailChange.NewEmail)
+			if err != nil {
+				return err
+			}
+
+			if existing != nil {
+				return ErrEmailInUse
+			}
+
+			_, err = ConsumeOneTimeToken(ctx, models.TokenPurposeEmailChangeConfirm, token)
+			if err != nil {
+				return err
+			}
+
+			// The link proves ownership of the new address, so it is verified
+			updates := map[string]interface{}{
+				"email":          emailChange.NewEmail,
+				"verified_email": true,
+				"updated_at":     time.Now(),
+			}
+
+			_, err = UpdateUser(ctx, emailChange.UserId, updates, models.EventUserUpdated)
+			if err != nil {
+				return err
+			}
+
+			return repository.ConfirmEmailChange(ctx, emailChange.Id)
+		})
+		if errors.Is(err, ErrEmailInUse) {
+			HandleError(c, http.StatusConflict, err)
+			return
+		}
+
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionEmailChangeConfirm, models.AuditOutcomeSuccess, emailChange.UserId, emailChange.UserId, map[string]interface{}{
+			"new_email": emailChange.NewEmail,
+		})
+
+		c.Redirect(http.StatusMovedPermanently, userFrontendURL(c.Request.Context(), s, oneTimeToken.UserId)+"/auth/login")
+	}
+}
+
+// CancelEmailChangeHandler handles the cancel link sent to the current address.
+// A pending change is dropped, a confirmed one is reverted to the old address
+func CancelEmailChangeHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("token is required"))
+			return
+		}
+
+		var oneTimeToken *models.OneTimeToken
+		var emailChange *models.EmailChange
+
+		reverted := false
+
+		err := repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			var err error
+
+			oneTimeToken, err = ConsumeOneTimeToken(ctx, models.TokenPurposeEmailChangeCancel, token)
+			if err != nil {
+				return err
+			}
+
+			emailChange, err = repository.GetEmailChangeByUserId(ctx, oneTimeToken.UserId)
+			if err != nil {
+				return err
+			}
+
+			if emailChange != nil {
+				if emailChange.Revertible() {
+					existing, err := repository.GetUserByEmail(ctx, emailChange.OldEmail)
+					if err != nil {
+						return err
+					}
+
+					if existing != nil && existing.Id != oneTimeToken.UserId {
+						return ErrEmailInUse
+					}
+
+					// The link proves ownership of the old address, so it is verified
+					_, err = UpdateUser(ctx, oneTimeToken.UserId, map[string]interface{}{
+						"email":          emailChange.OldEmail,
+						"verified_email": true,
+						"updated_at":     time.Now(),
+					}, models.EventUserUpdated)
+					if err != nil {
+						return err
+					}
+
+					reverted = true
+				}
+
+				err = repository.DeleteEmailChange(ctx, emailChange.Id)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = repository.DeleteOneTimeTokens(ctx, oneTimeToken.UserId, models.TokenPurposeEmailChangeConfirm)
+			if err != nil {
+				return err
+			}
+
+			// The change was not requested by the owner, close every session
+			_, err = repository.IncrementTokenVersion(ctx, oneTimeToken.UserId)
+			if err != nil {
+				return err
+			}
+
+			return repository.RevokeUserSessions(ctx, oneTimeToken.UserId, "")
+		})
+		if errors.Is(err, ErrEmailInUse) {
+			HandleError(c, http.StatusConflict, err)
+			return
+		}
+
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		if reverted {
+			RecordAudit(c, models.AuditActionEmailChangeRevert, models.AuditOutcomeSuccess, oneTimeToken.UserId, oneTimeToken.UserId, map[string]interface{}{
+				"old_email": emailChange.OldEmail,
+				"new_email": emailChange.NewEmail,
+			})
+		} else {
+			RecordAudit(c, models.AuditActionEmailChangeCancel, models.AuditOutcomeSuccess, oneTimeToken.UserId, oneTimeToken.UserId, nil)
+		}
+
+		c.Redirect(http.StatusMovedPermanently, userFrontendURL(c.Request.Context(), s, oneTimeToken.UserId)+"/auth/login")
+	}
+}
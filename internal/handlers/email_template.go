@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+)
+
+type EmailTemplateRequest struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type PreviewEmailTemplateRequest struct {
+	Subject   string            `json:"subject"`
+	HTML      string            `json:"html"`
+	Text      string            `json:"text"`
+	Variables map[string]string `json:"variables"`
+}
+
+type ListEmailTemplateResponse struct {
+	Names     []string                `json:"names"`
+	Locales   []string                `json:"locales"`
+	Overrides []*models.EmailTemplate `json:"overrides"`
+}
+
+type GetEmailTemplateResponse struct {
+	Template   *models.EmailTemplate `json:"template"`
+	IsOverride bool                  `json:"is_override"`
+}
+
+// templateSetRegexp matches the names of the template sets
+var templateSetRegexp = regexp.MustCompile(`^[a-z0-9_-]{0,64}$`)
+
+// emailTemplateParams returns the name and locale of the request path,
+// which must name a default template and a locale having templates, and
+// the template_set query parameter, empty for the overrides of every set
+func emailTemplateParams(c *gin.Context) (string, string, string, error) {
+	name := c.Param("name")
+	locale := c.Param("locale")
+	templateSet := c.Query("template_set")
+
+	known := false
+	for _, n := range mailer.TemplateNames() {
+		known = known || n == name
+	}
+
+	if !known {
+		return "", "", "", errors.New("unknown email template")
+	}
+
+	if mailer.SupportedLocale(locale) != locale {
+		return "", "", "", errors.New("unsupported locale")
+	}
+
+	if !templateSetRegexp.MatchString(templateSet) {
+		return "", "", "", errors.New("invalid template set")
+	}
+
+	return name, locale, templateSet, nil
+}
+
+// ListEmailTemplateHandler handles the list email template request
+func ListEmailTemplateHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		overrides, err := repository.ListEmailTemplate(c.Request.Context())
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := ListEmailTemplateResponse{
+			Names:     mailer.TemplateNames(),
+			Locales:   mailer.Locales(),
+			Overrides: overrides,
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", response)
+	}
+}
+
+// GetEmailTemplateHandler handles the get email template request, it
+// returns the override of the locale and template set, the override for
+// every set, or the default they replace
+func GetEmailTemplateHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, locale, templateSet, err := emailTemplateParams(c)
+		if err != nil {
+			HandleError(c, http.StatusNotFound, err)
+			return
+		}
+
+		template, err := repository.GetEmailTemplate(c.Request.Context(), name, locale, templateSet)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if template == nil && templateSet != "" {
+			template, err = repository.GetEmailTemplate(c.Request.Context(), name, locale, "")
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		if template != nil {
+			HandleSuccess(c, http.StatusOK, "ok", GetEmailTemplateResponse{Template: template, IsOverride: true})
+			return
+		}
+
+		template, err = mailer.DefaultTemplate(locale, name)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", GetEmailTemplateResponse{Template: template})
+	}
+}
+
+// UpdateEmailTemplateHandler handles the request to override a template
+// in a locale and template set. The template must render against the
+// sample variables
+func UpdateEmailTemplateHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, locale, templateSet, err := emailTemplateParams(c)
+		if err != nil {
+			HandleError(c, http.StatusNotFound, err)
+			return
+		}
+
+		var request = EmailTemplateRequest{}
+
+		err = c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		template := models.EmailTemplate{
+			Id:          id.String(),
+			Name:        name,
+			Locale:      locale,
+			TemplateSet: templateSet,
+			Subject:     request.Subject,
+			HTML:        request.HTML,
+			Text:        request.Text,
+		}
+
+		_, err = mailer.RenderTemplate(&template, mailer.SampleVariables(name))
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		t, err := repository.UpsertEmailTemplate(c.Request.Context(), &template)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		mailer.InvalidateOverrides(name)
+
+		RecordAudit(c, models.AuditActionEmailTemplateUpdate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"name":         name,
+			"locale":       locale,
+			"template_set": templateSet,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", t)
+	}
+}
+
+// DeleteEmailTemplateHandler handles the request to remove the override of
+// a template in a locale and template set
+func DeleteEmailTemplateHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, locale, templateSet, err := emailTemplateParams(c)
+		if err != nil {
+			HandleError(c, http.StatusNotFound, err)
+			return
+		}
+
+		template, err := repository.GetEmailTemplate(c.Request.Context(), name, locale, templateSet)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if template == nil {
+			HandleError(c, http.StatusNotFound, errors.New("email template override not found"))
+			return
+		}
+
+		err = repository.DeleteEmailTemplate(c.Request.Context(), name, locale, templateSet)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		mailer.InvalidateOverrides(name)
+
+		RecordAudit(c, models.AuditActionEmailTemplateDelete, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"name":         name,
+			"locale":       locale,
+			"template_set": templateSet,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// PreviewEmailTemplateHandler handles the preview of a template against
+// the sample variables, overridden by the given ones. A draft is rendered
+// when an HTML body is given, the template in use otherwise
+func PreviewEmailTemplateHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, locale, templateSet, err := emailTemplateParams(c)
+		if err != nil {
+			HandleError(c, http.StatusNotFound, err)
+			return
+		}
+
+		var request = PreviewEmailTemplateRequest{}
+
+		err = c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		variables := mailer.SampleVariables(name)
+		for key, value := range request.Variables {
+			variables[key] = value
+		}
+
+		var rendered *mailer.Rendered
+
+		if request.HTML != "" {
+			rendered, err = mailer.RenderTemplate(&models.EmailTemplate{
+				Name:    name,
+				Locale:  locale,
+				Subject: request.Subject,
+				HTML:    request.HTML,
+				Text:    request.Text,
+			}, variables)
+			if err != nil {
+				HandleError(c, http.StatusBadRequest, err)
+				return
+			}
+		} else {
+			rendered, err = mailer.Render(c.Request.Context(), templateSet, locale, name, variables)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", rendered)
+	}
+}
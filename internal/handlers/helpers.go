@@ -3,12 +3,21 @@ package handlers
 import (
 	"context"
 	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/events"
+	"github.com/tapiaw38/auth-api/internal/mailer"
 	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/rabbitmq"
 	"github.com/tapiaw38/auth-api/internal/repository"
 	"github.com/tapiaw38/auth-api/internal/server"
 	"github.com/tapiaw38/auth-api/internal/utils"
@@ -41,78 +50,288 @@ func AddRoleToUser(ctx context.Context, userId, roleName string) (*models.User,
 	return user, nil
 }
 
-// SaveVerifiedEmailToken saves the verified email token to the database
-func SaveVerifiedEmailToken(ctx context.Context, user *models.User, token string) error {
-	// Save the token to the database.
-	user.VerifiedEmailToken = token
-	user.VerifiedEmailTokenExpiry = time.Now().Add(time.Hour * 168)
+// CreateUser inserts a user with the default role and the given ones, and
+// publishes the user.created event, all in one transaction
+func CreateUser(ctx context.Context, user *models.User, roleIds ...string) (*models.User, error) {
+	var u *models.User
 
-	updates := map[string]interface{}{
-		"verified_email_token":        user.VerifiedEmailToken,
-		"verified_email_token_expiry": user.VerifiedEmailTokenExpiry,
-		"updated_at":                  time.Now(),
+	if user.Locale == "" {
+		user.Locale = mailer.DefaultLocale
 	}
 
-	_, err := repository.PartialUpdateUser(ctx, user.Id, updates)
+	err := repository.WithTx(ctx, func(ctx context.Context) error {
+		_, err := repository.InsertUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		// Add default role to user
+		u, err = AddRoleToUser(ctx, user.Id, "user")
+		if err != nil {
+			return err
+		}
+
+		if len(roleIds) > 0 {
+			granted := map[string]bool{}
+			for _, role := range u.Roles {
+				granted[role.Id] = true
+			}
+
+			for _, roleId := range roleIds {
+				if granted[roleId] {
+					continue
+				}
+
+				err = repository.InsertUserRole(ctx, &models.UserRole{UserId: user.Id, RoleId: roleId})
+				if err != nil {
+					return err
+				}
+
+				granted[roleId] = true
+			}
+
+			u, err = repository.GetUserById(ctx, user.Id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return events.Publish(ctx, models.EventUserCreated, events.NewUserPayload(u))
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return u, nil
 }
 
-// SavePasswordResetToken saves the password reset token to the database
-func SavePasswordResetToken(ctx context.Context, user *models.User, token string) error {
-	// Save the token to the database.
-	user.PasswordResetToken = token
-	user.PasswordResetTokenExpiry = time.Now().Add(time.Hour * 2)
+// UpdateUser partially updates a user and publishes the given event type,
+// all in one transaction
+func UpdateUser(ctx context.Context, id string, updates map[string]interface{}, eventType string) (*models.User, error) {
+	var u *models.User
 
-	updates := map[string]interface{}{
-		"password_reset_token":        user.PasswordResetToken,
-		"password_reset_token_expiry": user.PasswordResetTokenExpiry,
-		"updated_at":                  time.Now(),
+	err := repository.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = repository.PartialUpdateUser(ctx, id, updates)
+		if err != nil {
+			return err
+		}
+
+		if u == nil {
+			return nil
+		}
+
+		return events.Publish(ctx, eventType, events.NewUserPayload(u))
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := repository.PartialUpdateUser(ctx, user.Id, updates)
+	return u, nil
+}
+
+// Lifetime of the one time tokens sent by email
+const (
+	VerifyEmailTokenTTL   = time.Hour * 168
+	ResetPasswordTokenTTL = time.Hour * 2
+	EmailChangeTokenTTL   = time.Hour * 24
+	InvitationTokenTTL    = time.Hour * 168
+)
+
+// Lifetime of the session tokens
+const (
+	AccessTokenTTL  = time.Hour * 48
+	RefreshTokenTTL = time.Hour * 24 * 30
+)
+
+// ErrInvalidToken is returned when a one time token is unknown, expired or used
+var ErrInvalidToken = errors.New("token expired or invalid")
+
+// IssueOneTimeToken generates a token for a user and stores only its hash
+func IssueOneTimeToken(ctx context.Context, userId string, purpose string, ttl time.Duration) (string, error) {
+	id, err := ksuid.NewRandom()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	oneTimeToken := models.OneTimeToken{
+		Id:        id.String(),
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	err = repository.InsertOneTimeToken(ctx, &oneTimeToken)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeOneTimeToken validates a token for a purpose and marks it as used
+func ConsumeOneTimeToken(ctx context.Context, purpose string, token string) (*models.OneTimeToken, error) {
+	oneTimeToken, err := repository.ConsumeOneTimeToken(ctx, purpose, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if oneTimeToken == nil {
+		return nil, ErrInvalidToken
+	}
+
+	return oneTimeToken, nil
+}
+
+// LookupOneTimeToken validates a token for a purpose without using it
+func LookupOneTimeToken(ctx context.Context, purpose string, token string) (*models.OneTimeToken, error) {
+	oneTimeToken, err := repository.GetOneTimeToken(ctx, purpose, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if oneTimeToken == nil {
+		return nil, ErrInvalidToken
+	}
+
+	return oneTimeToken, nil
+}
+
+// HandleTokenError sends the response for a failed one time token validation
+func HandleTokenError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvalidToken) {
+		HandleError(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	HandleError(c, http.StatusInternalServerError, err)
+}
+
+// RequestLocale returns the preferred locale if supported, otherwise the
+// supported locale best matching the Accept-Language header
+func RequestLocale(c *gin.Context, preferred string) string {
+	if locale := mailer.SupportedLocale(preferred); locale != "" {
+		return locale
+	}
+
+	return mailer.MatchLocale(c.GetHeader("Accept-Language"))
+}
+
+// RequestApplication returns the active application named by the
+// X-Application-Id header, or nil when the header is missing
+func RequestApplication(c *gin.Context) (*models.Application, error) {
+	id := c.GetHeader(ApplicationHeader)
+	if id == "" {
+		return nil, nil
+	}
+
+	application, err := repository.GetApplicationById(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if application == nil || !application.IsActive {
+		return nil, ErrUnknownApplication
+	}
+
+	return application, nil
 }
 
-// DestroyVerifiedEmailToken destroys the verified email token
-func DestroyPasswordResetToken(ctx context.Context, user *models.User) error {
-	// Save the token to the database.
-	user.PasswordResetToken = ""
-	user.PasswordResetTokenExpiry = time.Time{}
+// DefaultApplication returns the branding of the users who did not sign up
+// through a registered application
+func DefaultApplication(s server.Server) *models.Application {
+	return &models.Application{
+		Name:          s.Config().AppName,
+		FrontendURL:   s.Config().FrontendURL,
+		SenderName:    s.Config().AppName,
+		SenderAddress: s.Config().EmailHostUser,
+		LogoURL:       s.Config().AppLogoURL,
+		IsActive:      true,
+	}
+}
 
-	updates := map[string]interface{}{
-		"password_reset_token":        user.PasswordResetToken,
-		"password_reset_token_expiry": user.PasswordResetTokenExpiry,
-		"updated_at":                  time.Now(),
+// UserApplication returns the application the user signed up through, the
+// default application when there is none
+func UserApplication(ctx context.Context, s server.Server, u *models.User) *models.Application {
+	if u.ApplicationId == "" {
+		return DefaultApplication(s)
 	}
 
-	_, err := repository.PartialUpdateUser(ctx, user.Id, updates)
+	application, err := repository.GetApplicationById(ctx, u.ApplicationId)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if application == nil {
+		return DefaultApplication(s)
+	}
+
+	return application
+}
+
+// userFrontendURL returns the frontend of the application of a user
+func userFrontendURL(ctx context.Context, s server.Server, userId string) string {
+	user, err := repository.GetUserById(ctx, userId)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if user == nil {
+		return DefaultApplication(s).FrontendURL
+	}
+
+	return UserApplication(ctx, s, user).FrontendURL
+}
+
+// publishEmail renders an email branded by the application of the user, in
+// the locale of the user, and queues it for delivery
+func publishEmail(s server.Server, application *models.Application, u *models.User, to string, templateName string, variables map[string]string) error {
+	ctx := context.Background()
+
+	variables["app_name"] = application.Name
+	variables["logo_url"] = application.LogoURL
+	variables["frontend_url"] = application.FrontendURL
+
+	// Mail providers favour senders offering a way to unsubscribe
+	listUnsubscribe := s.Config().EmailListUnsubscribe
+	if len(listUnsubscribe) == 0 {
+		listUnsubscribe = []string{"mailto:" + application.SenderAddress + "?subject=unsubscribe"}
+	}
+
+	message, err := rabbitmq.NewEmailMessage(ctx, &rabbitmq.EmailTemplate{
+		From:            mail.Address{Name: application.SenderName, Address: application.SenderAddress},
+		To:              to,
+		TemplateSet:     application.TemplateSet,
+		Locale:          u.Locale,
+		Name:            templateName,
+		Variables:       variables,
+		ListUnsubscribe: listUnsubscribe,
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return events.QueueEmail(ctx, s.Rabbit().Connection(), message)
 }
 
 // SendVerificationEmail sends an email verification email to a user
 func SendVerificationEmail(s server.Server, u *models.User, token string) error {
 
 	templateName := "email_verification"
-	subjet := "Bienvenido a Mi Tur"
+	application := UserApplication(context.Background(), s, u)
 
 	variables := map[string]string{
 		"name": u.FirstName + " " + u.LastName,
 		"link": s.Config().Domain + "/auth/verify-email?token=" + token,
 	}
 
-	err := s.Rabbit().Connection().PublishEmailMessage(u.Email, s.Config().EmailHostUser, subjet, templateName, variables)
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
 	if err != nil {
 		return err
 	}
@@ -124,14 +343,181 @@ func SendVerificationEmail(s server.Server, u *models.User, token string) error
 func SendResetPasswordEmail(s server.Server, u *models.User, token string) error {
 
 	templateName := "reset_password"
-	subjet := "Restablecer contraseña"
+	application := UserApplication(context.Background(), s, u)
+
+	variables := map[string]string{
+		"name": u.FirstName + " " + u.LastName,
+		"link": application.FrontendURL + "/auth/reset-password?token=" + token,
+	}
+
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendSignUpAttemptEmail warns an account holder that someone tried to sign
+// up again with their address
+func SendSignUpAttemptEmail(s server.Server, u *models.User) error {
+
+	templateName := "signup_attempt"
+	application := UserApplication(context.Background(), s, u)
+
+	variables := map[string]string{
+		"name": u.FirstName + " " + u.LastName,
+		"link": application.FrontendURL + "/auth/reset-password",
+	}
+
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendPasswordChangedEmail notifies a user that their password was changed
+func SendPasswordChangedEmail(s server.Server, u *models.User) error {
+
+	templateName := "password_changed"
+	application := UserApplication(context.Background(), s, u)
 
 	variables := map[string]string{
 		"name": u.FirstName + " " + u.LastName,
-		"link": s.Config().FrontendURL + "/auth/reset-password?token=" + token,
+		"link": application.FrontendURL + "/auth/reset-password",
+	}
+
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RequestEmailChange stores a pending email change and notifies both addresses
+func RequestEmailChange(ctx context.Context, s server.Server, user *models.User, newEmail string) error {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	emailChange := models.EmailChange{
+		Id:        id.String(),
+		UserId:    user.Id,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().Add(EmailChangeTokenTTL),
+	}
+
+	_, err = repository.InsertEmailChange(ctx, &emailChange)
+	if err != nil {
+		return err
+	}
+
+	confirmToken, err := IssueOneTimeToken(ctx, user.Id, models.TokenPurposeEmailChangeConfirm, EmailChangeTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	cancelToken, err := IssueOneTimeToken(ctx, user.Id, models.TokenPurposeEmailChangeCancel, EmailChangeTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	err = SendEmailChangeConfirmationEmail(s, user, newEmail, confirmToken)
+	if err != nil {
+		return err
+	}
+
+	return SendEmailChangeAlertEmail(s, user, newEmail, cancelToken)
+}
+
+// SendEmailChangeConfirmationEmail sends the confirmation link to the new address
+func SendEmailChangeConfirmationEmail(s server.Server, u *models.User, newEmail string, token string) error {
+
+	templateName := "email_change_confirmation"
+	application := UserApplication(context.Background(), s, u)
+
+	variables := map[string]string{
+		"name":  u.FirstName + " " + u.LastName,
+		"email": newEmail,
+		"link":  s.Config().Domain + "/auth/confirm-email-change?token=" + token,
+	}
+
+	err := publishEmail(s, application, u, newEmail, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendEmailChangeAlertEmail warns the current address and sends it a cancel link
+func SendEmailChangeAlertEmail(s server.Server, u *models.User, newEmail string, token string) error {
+
+	templateName := "email_change_alert"
+	application := UserApplication(context.Background(), s, u)
+
+	variables := map[string]string{
+		"name":  u.FirstName + " " + u.LastName,
+		"email": newEmail,
+		"link":  s.Config().Domain + "/auth/cancel-email-change?token=" + token,
+	}
+
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendInvitationEmail sends an invitation to create an account, branded by
+// the application it was issued for
+func SendInvitationEmail(s server.Server, invitation *models.Invitation, token string) error {
+
+	templateName := "invitation"
+
+	// The invitee has no account yet, the email is addressed as one
+	invitee := &models.User{
+		Email:         invitation.Email,
+		Locale:        invitation.Locale,
+		ApplicationId: invitation.ApplicationId,
+	}
+
+	application := UserApplication(context.Background(), s, invitee)
+
+	variables := map[string]string{
+		"name":       strings.TrimSpace(invitation.FirstName + " " + invitation.LastName),
+		"link":       application.FrontendURL + "/auth/accept-invitation?token=" + token,
+		"expires_at": invitation.ExpiresAt.Format("2006-01-02 15:04 MST"),
 	}
 
-	err := s.Rabbit().Connection().PublishEmailMessage(u.Email, s.Config().EmailHostUser, subjet, templateName, variables)
+	err := publishEmail(s, application, invitee, invitee.Email, templateName, variables)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendOrganizationInvitationEmail tells a user it has been invited to an
+// organization, the invitation is accepted once signed in
+func SendOrganizationInvitationEmail(s server.Server, u *models.User, organization *models.Organization) error {
+
+	templateName := "organization_invitation"
+	application := UserApplication(context.Background(), s, u)
+
+	variables := map[string]string{
+		"name":         u.FirstName + " " + u.LastName,
+		"organization": organization.Name,
+		"link":         application.FrontendURL + "/organizations/" + organization.Id + "/accept",
+	}
+
+	err := publishEmail(s, application, u, u.Email, templateName, variables)
 	if err != nil {
 		return err
 	}
@@ -171,21 +557,22 @@ func HandleGoogleLogin(c *gin.Context, s server.Server, request *SignUpLoginRequ
 			PhoneNumber:   "",
 			IsActive:      true,
 			VerifiedEmail: userInfo.VerifiedEmail,
+			Locale:        RequestLocale(c, ""),
 			CreatedAt:     time.Now(),
 			UpdatedAt:     time.Now(),
 		}
 
-		user, err = repository.InsertUser(c.Request.Context(), &userInsert)
+		// A bad application header must not prevent the login
+		application, err := RequestApplication(c)
 		if err != nil {
-			return nil, err
+			log.Println(err)
 		}
 
-		user, err := AddRoleToUser(c.Request.Context(), user.Id, "user")
-		if err != nil {
-			return nil, err
+		if application != nil {
+			userInsert.ApplicationId = application.Id
 		}
 
-		return user, nil
+		return CreateUser(c.Request.Context(), &userInsert)
 	}
 
 	// If user already registered, update user info
@@ -201,12 +588,12 @@ func HandleGoogleLogin(c *gin.Context, s server.Server, request *SignUpLoginRequ
 			"updated_at":     time.Now(),
 		}
 
-		user, err = repository.PartialUpdateUser(c.Request.Context(), user.Id, updates)
-		if err != nil {
-			return nil, err
+		eventType := models.EventUserUpdated
+		if !user.VerifiedEmail && userInfo.VerifiedEmail {
+			eventType = models.EventUserVerified
 		}
 
-		return user, nil
+		return UpdateUser(c.Request.Context(), user.Id, updates, eventType)
 	}
 
 	return user, nil
@@ -220,8 +607,11 @@ func HandleEmailAndPasswordLogin(c *gin.Context, request *SignUpLoginRequest) (*
 		return nil, err
 	}
 
-	if user == nil {
-		return nil, errors.New("user not found")
+	// Unknown accounts and accounts without a password still pay for a bcrypt
+	// compare so the response time does not reveal them
+	if user == nil || user.Password == "" {
+		ComparePassword(request.Password, string(dummyPasswordHash))
+		return nil, ErrInvalidCredentials
 	}
 
 	if err = ComparePassword(request.Password, user.Password); err != nil {
@@ -231,16 +621,165 @@ func HandleEmailAndPasswordLogin(c *gin.Context, request *SignUpLoginRequest) (*
 	return user, nil
 }
 
+// ApplicationHeader names the application a request is made through
+const ApplicationHeader = "X-Application-Id"
+
+// ErrUnknownApplication is returned for an unknown or inactive application
+var ErrUnknownApplication = errors.New("unknown application")
+
+// ErrInvalidCredentials is returned for any failed email and password login
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrAccountDisabled is returned when a deactivated user tries to log in
+var ErrAccountDisabled = errors.New("account disabled")
+
+// dummyPasswordHash is compared against when there is no real hash to check
+var dummyPasswordHash, _ = utils.HashPassword(utils.RandomString(16))
+
 // ComparePassword compares a password with a hash
 func ComparePassword(password, hash string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
-		return errors.New("invalid credentials")
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Limits of the jobs run detached from the requests
+const (
+	// BackgroundWorkers is the number of jobs run at once
+	BackgroundWorkers = 8
+	// BackgroundQueueSize is the number of jobs waiting for a worker, the
+	// jobs submitted while the queue is full are dropped
+	BackgroundQueueSize = 1024
+	// BackgroundTimeout bounds the run of a job
+	BackgroundTimeout = 30 * time.Second
+)
+
+var (
+	backgroundJobs    = make(chan func(ctx context.Context) error, BackgroundQueueSize)
+	backgroundWorkers sync.Once
+)
+
+// RunInBackground runs fn detached from the request, so the response does
+// not depend on which branch fn takes, and logs its error. The jobs are run
+// by a fixed pool of workers so that a flood of requests cannot pile them up
+func RunInBackground(fn func(ctx context.Context) error) {
+	backgroundWorkers.Do(func() {
+		for i := 0; i < BackgroundWorkers; i++ {
+			go runBackgroundJobs()
+		}
+	})
+
+	select {
+	case backgroundJobs <- fn:
+	default:
+		log.Println("background queue full, job dropped")
+	}
+}
+
+// runBackgroundJobs runs the queued jobs one after the other
+func runBackgroundJobs() {
+	for fn := range backgroundJobs {
+		ctx, cancel := context.WithTimeout(context.Background(), BackgroundTimeout)
+
+		if err := fn(ctx); err != nil {
+			log.Println(err)
+		}
+
+		cancel()
+	}
+}
+
+// ErrNotMember is returned when a user selects an organization they are
+// not an active member of
+var ErrNotMember = errors.New("not a member of the organization")
+
+// CheckMembership returns ErrNotMember unless the user is an active member
+// of the organization and the organization is active
+func CheckMembership(ctx context.Context, organizationId string, userId string) error {
+	organization, err := repository.GetOrganizationById(ctx, organizationId)
+	if err != nil {
+		return err
+	}
+
+	membership, err := repository.GetMembership(ctx, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	if organization == nil || !organization.IsActive || membership == nil || membership.Status != models.MembershipActive {
+		return ErrNotMember
 	}
 
 	return nil
 }
 
+// CreateSession records a new login of a user from the requesting device,
+// with the organization selected by its tokens
+func CreateSession(c *gin.Context, user *models.User, organizationId string) (*models.Session, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.Session{
+		Id:             id.String(),
+		UserId:         user.Id,
+		UserAgent:      c.Request.UserAgent(),
+		Ip:             c.ClientIP(),
+		TokenFamily:    family.String(),
+		OrganizationId: organizationId,
+	}
+
+	return repository.InsertSession(c.Request.Context(), &session)
+}
+
+// IssueRefreshToken generates a new refresh token for a session, replacing
+// the previous one. The token is prefixed with the session token family
+func IssueRefreshToken(ctx context.Context, session *models.Session) (string, error) {
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	token := session.TokenFamily + "." + secret
+
+	err = repository.RotateSessionRefreshToken(ctx, session.Id, utils.HashToken(token), time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GenerateUserToken generates a signed JWT token for a user session scoped
+// to an organization, none when organizationId is empty
+func GenerateUserToken(s server.Server, user *models.User, sessionId string, organizationId string) (string, error) {
+	claims := models.AppClaims{
+		UserId:       user.Id,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Verified:     user.VerifiedEmail,
+		SessionId:    sessionId,
+		OrgId:        organizationId,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(s.Config().JWTSecret))
+}
+
 // DecodeToten decodes a user token
 func DecodeToken(tokenString, secret string) (*models.AppClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -270,6 +809,8 @@ func GetUserResponse(user *models.User) *models.UserResponse {
 		Address:       user.Address,
 		IsActive:      user.IsActive,
 		VerifiedEmail: user.VerifiedEmail,
+		Locale:        user.Locale,
+		ApplicationId: user.ApplicationId,
 		Roles:         user.Roles,
 		CreatedAt:     user.CreatedAt,
 		UpdatedAt:     user.UpdatedAt,
@@ -285,3 +826,43 @@ func GetUsersResponse(users []*models.User) []*models.UserResponse {
 
 	return usersWithoutPassword
 }
+
+// ErrInvalidLimit is returned when the page size of a listing is not a
+// number within its bounds
+var ErrInvalidLimit = errors.New("invalid limit")
+
+// ParseLimit reads the limit of a paginated listing. It defaults to
+// defaultLimit and may not exceed maxLimit
+func ParseLimit(c *gin.Context, defaultLimit int, maxLimit int) (int, error) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, ErrInvalidLimit
+	}
+
+	return limit, nil
+}
+
+// ParsePage reads the limit and the cursor of a listing paginated by
+// (created_at, id). The cursor is zero on the first page
+func ParsePage(c *gin.Context, defaultLimit int, maxLimit int) (int, time.Time, string, error) {
+	limit, err := ParseLimit(c, defaultLimit, maxLimit)
+	if err != nil {
+		return 0, time.Time{}, "", err
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := utils.DecodeCursor(cursor)
+		if err != nil {
+			return 0, time.Time{}, "", err
+		}
+
+		return limit, createdAt, id, nil
+	}
+
+	return limit, time.Time{}, "", nil
+}
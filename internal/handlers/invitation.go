@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+type InvitationRequest struct {
+	Email         string   `json:"email"`
+	FirstName     string   `json:"first_name"`
+	LastName      string   `json:"last_name"`
+	RoleIds       []string `json:"role_ids"`
+	ApplicationId string   `json:"application_id"`
+	Locale        string   `json:"locale"`
+}
+
+type AcceptUserInvitationRequest struct {
+	Token     string `json:"token"`
+	Password  string `json:"password"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	SsoType   string `json:"sso_type"`
+	Code      string `json:"code"`
+}
+
+// ErrInvitationMismatch is returned when the google account accepting an
+// invitation is not the invited address
+var ErrInvitationMismatch = errors.New("the account does not match the invitation")
+
+// InsertInvitationHandler handles the invitation of a new user with
+// pre-assigned roles. Pending invitations of the same email are revoked
+func InsertInvitationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = InvitationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		request.Email = strings.TrimSpace(request.Email)
+		if !utils.ValidateEmail(request.Email) {
+			HandleError(c, http.StatusBadRequest, errors.New("invalid email"))
+			return
+		}
+
+		existing, err := repository.GetUserByEmail(c.Request.Context(), request.Email)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if existing != nil {
+			HandleError(c, http.StatusConflict, errors.New("email already in use"))
+			return
+		}
+
+		invitedBy := ""
+		if value, ok := c.Get(middleware.ClaimsKey); ok {
+			if claims, ok := value.(*models.AppClaims); ok {
+				invitedBy = claims.UserId
+			}
+		}
+
+		for _, roleId := range request.RoleIds {
+			role, err := repository.GetRoleById(c.Request.Context(), roleId)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if role == nil {
+				HandleError(c, http.StatusBadRequest, errors.New("role not found"))
+				return
+			}
+
+			if !checkRoleGrant(c, invitedBy, role, nil) {
+				return
+			}
+		}
+
+		if request.ApplicationId != "" {
+			application, err := repository.GetApplicationById(c.Request.Context(), request.ApplicationId)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if application == nil || !application.IsActive {
+				HandleError(c, http.StatusBadRequest, ErrUnknownApplication)
+				return
+			}
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		token, err := utils.GenerateToken()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		invitation := models.Invitation{
+			Id:            id.String(),
+			Email:         request.Email,
+			FirstName:     request.FirstName,
+			LastName:      request.LastName,
+			RoleIds:       request.RoleIds,
+			ApplicationId: request.ApplicationId,
+			Locale:        mailer.SupportedLocale(request.Locale),
+			TokenHash:     utils.HashToken(token),
+			ExpiresAt:     time.Now().Add(InvitationTokenTTL),
+			InvitedBy:     invitedBy,
+		}
+
+		if invitation.RoleIds == nil {
+			invitation.RoleIds = []string{}
+		}
+
+		if invitation.Locale == "" {
+			invitation.Locale = mailer.DefaultLocale
+		}
+
+		inv, err := repository.InsertInvitation(c.Request.Context(), &invitation)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		err = SendInvitationEmail(s, inv, token)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionInvitationCreate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"invitation_id": inv.Id,
+			"email":         inv.Email,
+			"role_ids":      inv.RoleIds,
+		})
+
+		HandleSuccess(c, http.StatusCreated, "ok", inv)
+	}
+}
+
+// ListInvitationHandler handles the list of the pending invitations
+func ListInvitationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitations, err := repository.ListPendingInvitation(c.Request.Context())
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if invitations == nil {
+			invitations = []*models.Invitation{}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", invitations)
+	}
+}
+
+// RevokeInvitationHandler handles the revocation of a pending invitation,
+// its link stops working
+func RevokeInvitationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		invitation, err := repository.GetInvitationById(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if invitation == nil || !invitation.AcceptedAt.IsZero() || !invitation.RevokedAt.IsZero() {
+			HandleError(c, http.StatusNotFound, errors.New("invitation not found"))
+			return
+		}
+
+		err = repository.RevokeInvitation(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionInvitationRevoke, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"invitation_id": id,
+			"email":         invitation.Email,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// AcceptUserInvitationHandler handles the acceptance of an invitation. The
+// account is created with the invited email, already verified since the
+// invitee followed the link, and the pre-assigned roles. The invitee either
+// sets a password or signs in with the google account of the invited email
+func AcceptUserInvitationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = AcceptUserInvitationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if request.Token == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("token is required"))
+			return
+		}
+
+		invitation, err := repository.GetPendingInvitationByTokenHash(c.Request.Context(), utils.HashToken(request.Token))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if invitation == nil {
+			HandleTokenError(c, ErrInvalidToken)
+			return
+		}
+
+		// The inviter must still be allowed to grant the roles
+		for _, roleId := range invitation.RoleIds {
+			role, err := repository.GetRoleById(c.Request.Context(), roleId)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if role == nil {
+				HandleError(c, http.StatusBadRequest, errors.New("role not found"))
+				return
+			}
+
+			if !checkRoleGrant(c, invitation.InvitedBy, role, nil) {
+				return
+			}
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		user := models.User{
+			Id:            id.String(),
+			FirstName:     request.FirstName,
+			LastName:      request.LastName,
+			Username:      request.Username,
+			Email:         invitation.Email,
+			IsActive:      true,
+			VerifiedEmail: true,
+			Locale:        invitation.Locale,
+			ApplicationId: invitation.ApplicationId,
+		}
+
+		method := "password"
+
+		if request.SsoType == "google" {
+			method = request.SsoType
+
+			token, err := s.Google().ExchangeCode(c.Request.Context(), request.Code)
+			if err != nil {
+				HandleError(c, http.StatusUnauthorized, err)
+				return
+			}
+
+			userInfo, err := s.Google().GetUserInfo(c.Request.Context(), token)
+			if err != nil {
+				HandleError(c, http.StatusUnauthorized, err)
+				return
+			}
+
+			if !userInfo.VerifiedEmail || !strings.EqualFold(userInfo.Email, invitation.Email) {
+				RecordAudit(c, models.AuditActionInvitationAccept, models.AuditOutcomeFailure, "", "", map[string]interface{}{
+					"invitation_id": invitation.Id,
+					"method":        method,
+					"reason":        "account_mismatch",
+				})
+				HandleError(c, http.StatusForbidden, ErrInvitationMismatch)
+				return
+			}
+
+			user.Picture = userInfo.Picture
+			if user.FirstName == "" && user.LastName == "" {
+				user.FirstName, user.LastName = userInfo.FirstName, userInfo.LastName
+			}
+		} else {
+			if len(request.Password) < MinPasswordLength {
+				HandleError(c, http.StatusBadRequest, fmt.Errorf("password must be at least %d characters long", MinPasswordLength))
+				return
+			}
+
+			hashedPassword, err := utils.HashPassword(request.Password)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			user.Password = string(hashedPassword)
+		}
+
+		if user.FirstName == "" && user.LastName == "" {
+			user.FirstName, user.LastName = invitation.FirstName, invitation.LastName
+		}
+
+		if user.Username == "" {
+			user.Username = utils.RandomString(30)
+		}
+
+		taken, err := repository.GetUserByUsername(c.Request.Context(), user.Username)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if taken != nil {
+			HandleError(c, http.StatusConflict, errors.New("username not available"))
+			return
+		}
+
+		existing, err := repository.GetUserByEmail(c.Request.Context(), invitation.Email)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if existing != nil {
+			HandleError(c, http.StatusConflict, errors.New("email already in use"))
+			return
+		}
+
+		var u *models.User
+
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			u, err = CreateUser(ctx, &user, invitation.RoleIds...)
+			if err != nil {
+				return err
+			}
+
+			// Only the first of concurrent acceptances creates the account
+			accepted, err := repository.AcceptInvitation(ctx, invitation.Id, u.Id)
+			if err != nil {
+				return err
+			}
+
+			if !accepted {
+				return ErrInvalidToken
+			}
+
+			return nil
+		})
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionInvitationAccept, models.AuditOutcomeSuccess, u.Id, u.Id, map[string]interface{}{
+			"invitation_id": invitation.Id,
+			"method":        method,
+		})
+
+		HandleSuccess(c, http.StatusCreated, "ok", GetUserResponse(u))
+	}
+}
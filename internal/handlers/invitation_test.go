@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+)
+
+// invitationRepository serves the users and roles read by the invitation
+// handlers, any other call panics
+type invitationRepository struct {
+	repository.Repository
+	users map[string]*models.User
+	roles map[string]*models.Role
+}
+
+func (r *invitationRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return r.users[id], nil
+}
+
+func (r *invitationRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *invitationRepository) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	return r.roles[id], nil
+}
+
+func TestInsertInvitationHandler(t *testing.T) {
+	t.Run("should forbid an admin to invite with the superadmin role", func(t *testing.T) {
+		c := require.New(t)
+
+		superadmin := models.Role{Id: "role-superadmin", Name: "superadmin"}
+		admin := models.Role{Id: "role-admin", Name: "admin"}
+
+		repository.SetRepository(&invitationRepository{
+			users: map[string]*models.User{
+				"admin": {Id: "admin", Email: "admin@example.com", Roles: []models.Role{admin}},
+			},
+			roles: map[string]*models.Role{
+				superadmin.Id: &superadmin,
+				admin.Id:      &admin,
+			},
+		})
+		defer repository.SetRepository(nil)
+
+		router := gin.New()
+		router.POST("/invitations", func(c *gin.Context) {
+			c.Set(middleware.ClaimsKey, &models.AppClaims{UserId: "admin"})
+		}, InsertInvitationHandler(&server.Broker{}))
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"email":    "attacker@example.com",
+			"role_ids": []string{superadmin.Id},
+		})
+		c.NoError(err)
+
+		r, err := http.NewRequest(http.MethodPost, "/invitations", bytes.NewBuffer(payload))
+		c.NoError(err)
+		r.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		c.Equal(http.StatusForbidden, w.Code)
+	})
+}
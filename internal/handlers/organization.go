@@ -0,0 +1,701 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/events"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+// OrganizationAdminRole is the role granted within an organization to its
+// creator, it manages the members of the organization
+const OrganizationAdminRole = "admin"
+
+// ErrLastAdmin is returned when a change would leave an organization
+// without an admin
+var ErrLastAdmin = errors.New("the organization must keep an admin")
+
+// keepOrganizationAdmin fails with ErrLastAdmin when the user is the last
+// admin of the organization. Called inside repository.WithTx, the
+// organization stays locked until the removal is committed
+func keepOrganizationAdmin(ctx context.Context, organizationId string, userId string) error {
+	admins, err := repository.CountMembersWithRole(ctx, organizationId, OrganizationAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if admins > 1 {
+		return nil
+	}
+
+	membership, err := repository.GetMembership(ctx, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	if membership != nil && membership.Status == models.MembershipActive && membership.HasRole(OrganizationAdminRole) {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// removeMembership removes a user from an organization unless the user is
+// its last admin
+func removeMembership(c *gin.Context, organizationId string, userId string) bool {
+	err := repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+		err := keepOrganizationAdmin(ctx, organizationId, userId)
+		if err != nil {
+			return err
+		}
+
+		return repository.DeleteMembership(ctx, organizationId, userId)
+	})
+	if errors.Is(err, ErrLastAdmin) {
+		HandleError(c, http.StatusConflict, err)
+		return false
+	}
+
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationId string `json:"organization_id"`
+}
+
+type InviteMemberRequest struct {
+	Email   string   `json:"email"`
+	RoleIds []string `json:"role_ids"`
+}
+
+type MemberRoleRequest struct {
+	RoleId string `json:"role_id"`
+}
+
+// slugRegexp matches the slugs of the organizations
+var slugRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,62}[a-z0-9])?$`)
+
+// validateOrganization checks the name and slug of an organization, the
+// slug must not be taken by another organization
+func validateOrganization(ctx context.Context, organization *models.Organization) (int, error) {
+	if strings.TrimSpace(organization.Name) == "" {
+		return http.StatusBadRequest, errors.New("name is required")
+	}
+
+	if !slugRegexp.MatchString(organization.Slug) {
+		return http.StatusBadRequest, errors.New("invalid slug")
+	}
+
+	existing, err := repository.GetOrganizationBySlug(ctx, organization.Slug)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if existing != nil && existing.Id != organization.Id {
+		return http.StatusConflict, errors.New("slug not available")
+	}
+
+	return http.StatusOK, nil
+}
+
+// currentOrganization returns the organization set by RequireOrganization
+func currentOrganization(c *gin.Context) *models.Organization {
+	return c.MustGet(middleware.OrganizationKey).(*models.Organization)
+}
+
+// InsertOrganizationHandler handles the insert organization request, the
+// caller becomes its first member with the admin role
+func InsertOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var request = OrganizationRequest{}
+
+		err = c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		organization := models.Organization{
+			Id:       id.String(),
+			Name:     strings.TrimSpace(request.Name),
+			Slug:     request.Slug,
+			IsActive: true,
+		}
+
+		status, err := validateOrganization(c.Request.Context(), &organization)
+		if err != nil {
+			HandleError(c, status, err)
+			return
+		}
+
+		role, err := repository.GetRoleByName(c.Request.Context(), OrganizationAdminRole)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if role == nil {
+			HandleError(c, http.StatusInternalServerError, errors.New("admin role not found"))
+			return
+		}
+
+		var org *models.Organization
+
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			org, err = repository.InsertOrganization(ctx, &organization)
+			if err != nil {
+				return err
+			}
+
+			_, err = repository.InsertMembership(ctx, &models.Membership{
+				OrganizationId: org.Id,
+				UserId:         claims.UserId,
+				Status:         models.MembershipActive,
+			})
+			if err != nil {
+				return err
+			}
+
+			return repository.InsertUserRole(ctx, &models.UserRole{
+				UserId:         claims.UserId,
+				RoleId:         role.Id,
+				OrganizationId: org.Id,
+			})
+		})
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionOrganizationCreate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"organization_id": org.Id,
+			"slug":            org.Slug,
+		})
+
+		HandleSuccess(c, http.StatusCreated, "ok", org)
+	}
+}
+
+// ListMyOrganizationHandler handles the list of the memberships and the
+// pending invitations of the authenticated user
+func ListMyOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		memberships, err := repository.ListUserMembership(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if memberships == nil {
+			memberships = []*models.Membership{}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", memberships)
+	}
+}
+
+// SwitchOrganizationHandler handles the selection of the organization the
+// tokens of the current session are scoped to, an empty organization id
+// clears it. A new access token is issued
+func SwitchOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var request = SwitchOrganizationRequest{}
+
+		err = c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if request.OrganizationId != "" {
+			err = CheckMembership(c.Request.Context(), request.OrganizationId, claims.UserId)
+			if errors.Is(err, ErrNotMember) {
+				HandleError(c, http.StatusForbidden, err)
+				return
+			}
+
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		user, err := repository.GetUserById(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user == nil {
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		// Refreshed tokens keep the organization of the session
+		err = repository.SetSessionOrganization(c.Request.Context(), claims.SessionId, request.OrganizationId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		token, err := GenerateUserToken(s, user, claims.SessionId, request.OrganizationId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionOrganizationSwitch, models.AuditOutcomeSuccess, "", user.Id, map[string]interface{}{
+			"session_id":      claims.SessionId,
+			"organization_id": request.OrganizationId,
+		})
+
+		if s.Config().CookieMode {
+			setCookie(c, s, middleware.AccessTokenCookie, token, "/", int(AccessTokenTTL.Seconds()), true)
+			HandleSuccess(c, http.StatusOK, "ok", nil)
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", map[string]interface{}{
+			"token": token,
+		})
+	}
+}
+
+// AcceptInvitationHandler handles the acceptance of the invitation of the
+// authenticated user to an organization
+func AcceptInvitationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		organizationId := c.Param("id")
+
+		membership, err := repository.GetMembership(c.Request.Context(), organizationId, claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if membership == nil || membership.Status != models.MembershipInvited {
+			HandleError(c, http.StatusNotFound, errors.New("invitation not found"))
+			return
+		}
+
+		err = repository.UpdateMembershipStatus(c.Request.Context(), organizationId, claims.UserId, models.MembershipActive)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionMembershipAccept, models.AuditOutcomeSuccess, "", claims.UserId, map[string]interface{}{
+			"organization_id": organizationId,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// LeaveOrganizationHandler handles the request of the authenticated user
+// to leave an organization or decline an invitation to it
+func LeaveOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		organizationId := c.Param("id")
+
+		membership, err := repository.GetMembership(c.Request.Context(), organizationId, claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if membership == nil {
+			HandleError(c, http.StatusNotFound, errors.New("membership not found"))
+			return
+		}
+
+		if !removeMembership(c, organizationId, claims.UserId) {
+			return
+		}
+
+		RecordAudit(c, models.AuditActionMembershipRemove, models.AuditOutcomeSuccess, "", claims.UserId, map[string]interface{}{
+			"organization_id": organizationId,
+			"status":          membership.Status,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// GetCurrentOrganizationHandler handles the get request of the organization
+// selected by the token
+func GetCurrentOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		HandleSuccess(c, http.StatusOK, "ok", currentOrganization(c))
+	}
+}
+
+// UpdateCurrentOrganizationHandler handles the update request of the
+// organization selected by the token, only the given fields are changed
+func UpdateCurrentOrganizationHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = OrganizationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		organization := *currentOrganization(c)
+
+		if request.Name != "" {
+			organization.Name = strings.TrimSpace(request.Name)
+		}
+
+		if request.Slug != "" {
+			organization.Slug = request.Slug
+		}
+
+		status, err := validateOrganization(c.Request.Context(), &organization)
+		if err != nil {
+			HandleError(c, status, err)
+			return
+		}
+
+		org, err := repository.UpdateOrganization(c.Request.Context(), &organization)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionOrganizationUpdate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"organization_id": org.Id,
+			"name":            org.Name,
+			"slug":            org.Slug,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", org)
+	}
+}
+
+// ListMemberHandler handles the list of the members and the pending
+// invitations of the organization selected by the token
+func ListMemberHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		memberships, err := repository.ListMembership(c.Request.Context(), currentOrganization(c).Id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if memberships == nil {
+			memberships = []*models.Membership{}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", memberships)
+	}
+}
+
+// InviteMemberHandler handles the invitation of a user to the organization
+// selected by the token, with the roles granted once accepted. The response
+// is the same whether or not the email belongs to an account, or to one
+// already invited, so that it cannot be used to discover accounts
+func InviteMemberHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = InviteMemberRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		request.Email = strings.TrimSpace(request.Email)
+		if !utils.ValidateEmail(request.Email) {
+			HandleError(c, http.StatusBadRequest, errors.New("invalid email"))
+			return
+		}
+
+		for _, roleId := range request.RoleIds {
+			role, err := repository.GetRoleById(c.Request.Context(), roleId)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if role == nil {
+				HandleError(c, http.StatusBadRequest, errors.New("role not found"))
+				return
+			}
+		}
+
+		organization := currentOrganization(c)
+		accepted := "if the email belongs to an account, an invitation has been sent"
+
+		user, err := repository.GetUserByEmail(c.Request.Context(), request.Email)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user == nil {
+			HandleSuccess(c, http.StatusAccepted, accepted, nil)
+			return
+		}
+
+		existing, err := repository.GetMembership(c.Request.Context(), organization.Id, user.Id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if existing != nil {
+			HandleSuccess(c, http.StatusAccepted, accepted, nil)
+			return
+		}
+
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			_, err := repository.InsertMembership(ctx, &models.Membership{
+				OrganizationId: organization.Id,
+				UserId:         user.Id,
+				Status:         models.MembershipInvited,
+				InvitedBy:      c.MustGet(middleware.MembershipKey).(*models.Membership).UserId,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, roleId := range request.RoleIds {
+				err = repository.InsertUserRole(ctx, &models.UserRole{
+					UserId:         user.Id,
+					RoleId:         roleId,
+					OrganizationId: organization.Id,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		// A failure to notify must not tell the account apart either
+		err = SendOrganizationInvitationEmail(s, user, organization)
+		if err != nil {
+			log.Println(err)
+		}
+
+		RecordAudit(c, models.AuditActionMembershipInvite, models.AuditOutcomeSuccess, "", user.Id, map[string]interface{}{
+			"organization_id": organization.Id,
+			"role_ids":        request.RoleIds,
+		})
+
+		HandleSuccess(c, http.StatusAccepted, accepted, nil)
+	}
+}
+
+// RemoveMemberHandler handles the removal of a member, or the withdrawal
+// of an invitation, of the organization selected by the token
+func RemoveMemberHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		organization := currentOrganization(c)
+		userId := c.Param("user_id")
+
+		membership, err := repository.GetMembership(c.Request.Context(), organization.Id, userId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if membership == nil {
+			HandleError(c, http.StatusNotFound, errors.New("membership not found"))
+			return
+		}
+
+		if !removeMembership(c, organization.Id, userId) {
+			return
+		}
+
+		RecordAudit(c, models.AuditActionMembershipRemove, models.AuditOutcomeSuccess, "", userId, map[string]interface{}{
+			"organization_id": organization.Id,
+			"status":          membership.Status,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// GrantMemberRoleHandler handles the grant of a role to a member within
+// the organization selected by the token
+func GrantMemberRoleHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = MemberRoleRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		changeMemberRole(c, c.Param("user_id"), request.RoleId, true)
+	}
+}
+
+// RevokeMemberRoleHandler handles the revocation of a role of a member
+// within the organization selected by the token
+func RevokeMemberRoleHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeMemberRole(c, c.Param("user_id"), c.Param("role_id"), false)
+	}
+}
+
+// changeMemberRole grants or revokes a role of a member of the current
+// organization and publishes the matching event
+func changeMemberRole(c *gin.Context, userId string, roleId string, grant bool) {
+	organization := currentOrganization(c)
+
+	membership, err := repository.GetMembership(c.Request.Context(), organization.Id, userId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if membership == nil {
+		HandleError(c, http.StatusNotFound, errors.New("membership not found"))
+		return
+	}
+
+	role, err := repository.GetRoleById(c.Request.Context(), roleId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if role == nil {
+		HandleError(c, http.StatusBadRequest, errors.New("role not found"))
+		return
+	}
+
+	// Granting a role already held changes nothing
+	if grant && membership.HasRole(role.Name) {
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+		return
+	}
+
+	userRole := models.UserRole{
+		UserId:         userId,
+		RoleId:         roleId,
+		OrganizationId: organization.Id,
+	}
+
+	event, action := models.EventRoleGranted, models.AuditActionRoleGrant
+	if !grant {
+		event, action = models.EventRoleRevoked, models.AuditActionRoleRevoke
+	}
+
+	err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+		if grant {
+			err = repository.InsertUserRole(ctx, &userRole)
+		} else {
+			if role.Name == OrganizationAdminRole {
+				if err = keepOrganizationAdmin(ctx, organization.Id, userId); err != nil {
+					return err
+				}
+			}
+
+			err = repository.DeleteUserRole(ctx, &userRole)
+		}
+		if err != nil {
+			return err
+		}
+
+		return events.Publish(ctx, event, &models.RoleEventPayload{
+			UserId:         userRole.UserId,
+			RoleId:         userRole.RoleId,
+			OrganizationId: userRole.OrganizationId,
+		})
+	})
+	if errors.Is(err, ErrLastAdmin) {
+		HandleError(c, http.StatusConflict, err)
+		return
+	}
+
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	RecordAudit(c, action, models.AuditOutcomeSuccess, "", userId, map[string]interface{}{
+		"role_id":         roleId,
+		"organization_id": organization.Id,
+	})
+
+	HandleSuccess(c, http.StatusOK, "ok", nil)
+}
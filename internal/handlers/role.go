@@ -43,6 +43,11 @@ func InsertRoleHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		RecordAudit(c, models.AuditActionRoleCreate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"role_id": rl.Id,
+			"name":    rl.Name,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", rl)
 	}
 }
@@ -113,6 +118,11 @@ func UpdateRoleHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		RecordAudit(c, models.AuditActionRoleUpdate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"role_id": id,
+			"name":    request.Name,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", rl)
 	}
 }
@@ -132,6 +142,10 @@ func DeleteRoleHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		RecordAudit(c, models.AuditActionRoleDelete, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"role_id": id,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", role)
 	}
 }
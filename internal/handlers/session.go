@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/middleware"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// GetSessionsResponse returns a list of sessions flagging the current one
+func GetSessionsResponse(sessions []*models.Session, currentId string) []*SessionResponse {
+	var response []*SessionResponse
+	for _, session := range sessions {
+		response = append(response, &SessionResponse{
+			Session: *session,
+			Current: session.Id == currentId,
+		})
+	}
+
+	return response
+}
+
+// ListMySessionHandler handles the list of the active sessions of the authenticated user
+func ListMySessionHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		sessions, err := repository.ListSession(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", GetSessionsResponse(sessions, claims.SessionId))
+	}
+}
+
+// RevokeMySessionHandler handles the revocation of a session of the authenticated user
+func RevokeMySessionHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		revokeSession(c, claims.UserId, c.Param("id"))
+	}
+}
+
+// ListUserSessionHandler handles the list of the active sessions of any user
+func ListUserSessionHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("id is required"))
+			return
+		}
+
+		sessions, err := repository.ListSession(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", GetSessionsResponse(sessions, ""))
+	}
+}
+
+// RevokeUserSessionHandler handles the revocation of a session of any user
+func RevokeUserSessionHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revokeSession(c, c.Param("id"), c.Param("session_id"))
+	}
+}
+
+// revokeSession revokes a session after checking it belongs to the user
+func revokeSession(c *gin.Context, userId string, sessionId string) {
+	if sessionId == "" {
+		HandleError(c, http.StatusBadRequest, errors.New("id is required"))
+		return
+	}
+
+	session, err := repository.GetSessionById(c.Request.Context(), sessionId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if session == nil || session.UserId != userId {
+		HandleError(c, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+
+	err = repository.RevokeSession(c.Request.Context(), session.Id)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	RecordAudit(c, models.AuditActionSessionRevoke, models.AuditOutcomeSuccess, "", userId, map[string]interface{}{
+		"session_id": session.Id,
+	})
+
+	HandleSuccess(c, http.StatusOK, "ok", nil)
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token,
+// rotating the refresh token of the session
+func RefreshTokenHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refreshToken, _ := c.Cookie(middleware.RefreshTokenCookie)
+		if refreshToken == "" {
+			var request = RefreshTokenRequest{}
+
+			err := c.BindJSON(&request)
+			if err != nil {
+				HandleError(c, http.StatusBadRequest, err)
+				return
+			}
+
+			refreshToken = request.RefreshToken
+		}
+
+		family := strings.SplitN(refreshToken, ".", 2)[0]
+		if family == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("refresh token is required"))
+			return
+		}
+
+		session, err := repository.GetSessionByTokenFamily(c.Request.Context(), family)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if session == nil || !session.RevokedAt.IsZero() {
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		hash := utils.HashToken(refreshToken)
+		if subtle.ConstantTimeCompare([]byte(session.RefreshTokenHash), []byte(hash)) != 1 {
+			// A rotated token of the family was replayed, it may be stolen
+			err = repository.RevokeSession(c.Request.Context(), session.Id)
+			if err != nil {
+				log.Println(err)
+			}
+
+			RecordAudit(c, models.AuditActionRefreshToken, models.AuditOutcomeFailure, "", session.UserId, map[string]interface{}{
+				"session_id": session.Id,
+				"reason":     "refresh_token_reuse",
+			})
+
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		if time.Now().After(session.RefreshTokenExpiresAt) {
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		user, err := repository.GetUserById(c.Request.Context(), session.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if user == nil || !user.IsActive {
+			HandleError(c, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+
+		tokenString, err := GenerateUserToken(s, user, session.Id, session.OrganizationId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		refreshToken, err = IssueRefreshToken(c.Request.Context(), session)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionRefreshToken, models.AuditOutcomeSuccess, user.Id, user.Id, map[string]interface{}{
+			"session_id": session.Id,
+		})
+
+		if s.Config().CookieMode {
+			err = SetAuthCookies(c, s, tokenString, refreshToken)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			HandleSuccess(c, http.StatusOK, "ok", nil)
+			return
+		}
+
+		data := map[string]interface{}{
+			"token":         tokenString,
+			"refresh_token": refreshToken,
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", data)
+	}
+}
+
+// LogoutHandler revokes the current session and clears the auth cookies
+func LogoutHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := middleware.GetTokenString(c)
+
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		err = repository.RevokeSession(c.Request.Context(), claims.SessionId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionLogout, models.AuditOutcomeSuccess, claims.UserId, claims.UserId, map[string]interface{}{
+			"session_id": claims.SessionId,
+		})
+
+		if s.Config().CookieMode {
+			ClearAuthCookies(c, s)
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/config"
+	"github.com/tapiaw38/auth-api/internal/cache"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+	"github.com/tapiaw38/auth-api/internal/middleware"
 	"github.com/tapiaw38/auth-api/internal/models"
 	"github.com/tapiaw38/auth-api/internal/repository"
 	"github.com/tapiaw38/auth-api/internal/server"
@@ -17,21 +23,24 @@ import (
 )
 
 type SignUpLoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	SsoType  string `json:"sso_type"`
-	Code     string `json:"code"`
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	SsoType        string `json:"sso_type"`
+	Code           string `json:"code"`
+	OrganizationId string `json:"organization_id"`
 }
 
 type SignUpResponse struct {
-	Id    string `json:"id"`
-	Email string `json:"email"`
-	Token string `json:"token"`
+	Id      string `json:"id"`
+	Email   string `json:"email"`
+	Token   string `json:"token"`
+	Message string `json:"message"`
 }
 
 type LoginResponse struct {
-	User  models.UserResponse `json:"user"`
-	Token string              `json:"token"`
+	User         models.UserResponse `json:"user"`
+	Token        string              `json:"token,omitempty"`
+	RefreshToken string              `json:"refresh_token,omitempty"`
 }
 
 type UserUpdateRequest struct {
@@ -44,6 +53,10 @@ type UserUpdateRequest struct {
 	Address     string `json:"address"`
 }
 
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
 type ResetPasswordRequest struct {
 	Email string `json:"email"`
 }
@@ -53,6 +66,22 @@ type ChangePasswordRequest struct {
 	Token    string `json:"token"`
 }
 
+type UpdatePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+const (
+	// MinPasswordLength is the minimum length accepted for a new password
+	MinPasswordLength = 8
+	// ReauthenticationWindow is how recent a login must be to change the
+	// password of an account that has no password (e.g. google sign in)
+	ReauthenticationWindow = 10 * time.Minute
+	// VerificationResendInterval is the minimum time between two
+	// verification emails sent to the same address
+	VerificationResendInterval = time.Minute
+)
+
 // SignUpHandler handles the sign up request
 func SignUpHandler(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -69,12 +98,38 @@ func SignUpHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		application, err := RequestApplication(c)
+		if errors.Is(err, ErrUnknownApplication) {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
 		hashedPassword, err := utils.HashPassword(request.Password)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		// Usernames are checked first so their result does not depend on the email
+		taken, err := repository.GetUserByUsername(c.Request.Context(), request.Username)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if taken != nil {
+			RecordAudit(c, models.AuditActionSignUp, models.AuditOutcomeFailure, "", "", map[string]interface{}{
+				"email":  request.Email,
+				"reason": "username_taken",
+			})
+			HandleError(c, http.StatusConflict, errors.New("username not available"))
+			return
+		}
+
 		id, err := ksuid.NewRandom()
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
@@ -93,64 +148,64 @@ func SignUpHandler(s server.Server) gin.HandlerFunc {
 			Address:       request.Address,
 			IsActive:      true,
 			VerifiedEmail: false,
+			Locale:        RequestLocale(c, request.Locale),
 		}
 
-		u, err := repository.InsertUser(c.Request.Context(), &user)
-		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
-			return
+		if application != nil {
+			user.ApplicationId = application.Id
 		}
 
-		// Add default role to user
-		_, err = AddRoleToUser(c.Request.Context(), u.Id, "user")
+		// The token has no session, it only keeps the response of the
+		// previous versions and is refused until the user logs in
+		token, err := GenerateUserToken(s, &user, "", "")
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Generate token and save it
-		token, err := utils.GenerateToken()
-		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
-			return
+		// The same response is sent whether or not the email is registered
+		signUpResponse := SignUpResponse{
+			Id:      user.Id,
+			Email:   user.Email,
+			Token:   token,
+			Message: "Please follow the link sent to your email address to verify your account.",
 		}
 
-		// Save token
-		err = SaveVerifiedEmailToken(c.Request.Context(), u, token)
-		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
-			return
-		}
+		ip, userAgent := c.ClientIP(), c.Request.UserAgent()
 
-		// Send verification email
-		err = SendVerificationEmail(s, u, token)
-		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
-			return
-		}
+		// The account is created, or its holder warned, detached from the
+		// request so the response time does not reveal registered emails
+		RunInBackground(func(ctx context.Context) error {
+			existing, err := repository.GetUserByEmail(ctx, user.Email)
+			if err != nil {
+				return err
+			}
 
-		// Generate JWT token
-		claims := models.AppClaims{
-			UserId: u.Id,
-			Email:  u.Email,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(2 * time.Hour * 24).Unix(),
-			},
-		}
+			if existing != nil {
+				recordAudit(ctx, ip, userAgent, models.AuditActionSignUp, models.AuditOutcomeFailure, "", existing.Id, map[string]interface{}{
+					"email":  user.Email,
+					"reason": "email_taken",
+				})
 
-		ClaimsToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		ClaimsTokenString, err := ClaimsToken.SignedString([]byte(s.Config().JWTSecret))
-		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
-			return
-		}
+				// Warn the real account holder instead of the caller
+				return SendSignUpAttemptEmail(s, existing)
+			}
 
-		// Send response
-		signUpResponse := SignUpResponse{
-			Id:    u.Id,
-			Email: u.Email,
-			Token: ClaimsTokenString,
-		}
+			u, err := CreateUser(ctx, &user)
+			if err != nil {
+				return err
+			}
+
+			// Generate token and save its hash
+			token, err := IssueOneTimeToken(ctx, u.Id, models.TokenPurposeVerifyEmail, VerifyEmailTokenTTL)
+			if err != nil {
+				return err
+			}
+
+			recordAudit(ctx, ip, userAgent, models.AuditActionSignUp, models.AuditOutcomeSuccess, u.Id, u.Id, nil)
+
+			return SendVerificationEmail(s, u, token)
+		})
 
 		HandleSuccess(c, http.StatusCreated, "ok", signUpResponse)
 	}
@@ -165,26 +220,85 @@ func VerifiedEmailHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
-		user, err := repository.GetUserByVerifiedEmailToken(c.Request.Context(), token)
+		oneTimeToken, err := ConsumeOneTimeToken(c.Request.Context(), models.TokenPurposeVerifyEmail, token)
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		updates := map[string]interface{}{
+			"verified_email": true,
+			"updated_at":     time.Now(),
+		}
+
+		user, err := UpdateUser(c.Request.Context(), oneTimeToken.UserId, updates, models.EventUserVerified)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		if time.Now().After(user.VerifiedEmailTokenExpiry) {
-			HandleError(c, http.StatusUnauthorized, errors.New("token expired"))
+		RecordAudit(c, models.AuditActionVerifyEmail, models.AuditOutcomeSuccess, oneTimeToken.UserId, oneTimeToken.UserId, nil)
+
+		c.Redirect(http.StatusMovedPermanently, UserApplication(c.Request.Context(), s, user).FrontendURL+"/auth/login")
+	}
+}
+
+// ResendVerificationEmailHandler handles the request for a new verification email
+func ResendVerificationEmailHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = ResendVerificationRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
 			return
 		}
 
-		user.VerifiedEmail = true
+		request.Email = strings.TrimSpace(request.Email)
+		if !utils.ValidateEmail(request.Email) {
+			HandleError(c, http.StatusBadRequest, errors.New("invalid email"))
+			return
+		}
 
-		_, err = repository.UpdateUser(c.Request.Context(), user.Id, user)
+		// Throttle by address so unknown emails are limited the same way, the
+		// case of the address does not make a new one
+		allowed, err := s.Redis().Allow("verify-email-resend:"+strings.ToLower(request.Email), VerificationResendInterval)
 		if err != nil {
-			HandleError(c, http.StatusInternalServerError, err)
+			log.Println(err)
+		} else if !allowed {
+			HandleError(c, http.StatusTooManyRequests, errors.New("too many requests, try again later"))
 			return
 		}
 
-		c.Redirect(http.StatusMovedPermanently, s.Config().FrontendURL+"/auth/login")
+		RecordAudit(c, models.AuditActionResendVerification, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"email": request.Email,
+		})
+
+		data := map[string]interface{}{
+			"email":   request.Email,
+			"message": "If the address belongs to an unverified account, a new verification link has been sent.",
+		}
+
+		RunInBackground(func(ctx context.Context) error {
+			user, err := repository.GetUserByEmail(ctx, request.Email)
+			if err != nil {
+				return err
+			}
+
+			if user == nil || user.VerifiedEmail {
+				return nil
+			}
+
+			// Generate token and save its hash
+			token, err := IssueOneTimeToken(ctx, user.Id, models.TokenPurposeVerifyEmail, VerifyEmailTokenTTL)
+			if err != nil {
+				return err
+			}
+
+			return SendVerificationEmail(s, user, token)
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", data)
 	}
 }
 
@@ -204,97 +318,213 @@ func ResetPasswordHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
-		user, err := repository.GetUserByEmail(c.Request.Context(), request.Email)
+		// Unknown emails get the same response, the work runs detached from
+		// the request so the response time does not reveal them either
+		RunInBackground(func(ctx context.Context) error {
+			user, err := repository.GetUserByEmail(ctx, request.Email)
+			if err != nil {
+				return err
+			}
+
+			if user == nil {
+				return nil
+			}
+
+			// Generate token and save its hash
+			token, err := IssueOneTimeToken(ctx, user.Id, models.TokenPurposeResetPassword, ResetPasswordTokenTTL)
+			if err != nil {
+				return err
+			}
+
+			// Send reset password email
+			return SendResetPasswordEmail(s, user, token)
+		})
+
+		RecordAudit(c, models.AuditActionPasswordResetRequest, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"email": request.Email,
+		})
+
+		data := map[string]interface{}{
+			"email":   request.Email,
+			"message": "If the address belongs to an account, a password reset link has been sent to it. Please follow the link to reset your password.",
+		}
+		HandleSuccess(c, http.StatusOK, "ok", data)
+	}
+}
+
+func ChangePasswordHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = ChangePasswordRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if request.Token == "" {
+			HandleError(c, http.StatusBadRequest, errors.New("token is required"))
+			return
+		}
+
+		oneTimeToken, err := ConsumeOneTimeToken(c.Request.Context(), models.TokenPurposeResetPassword, request.Token)
+		if err != nil {
+			HandleTokenError(c, err)
+			return
+		}
+
+		hashedPassword, err := utils.HashPassword(request.Password)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Generate token and save it
-		token, err := utils.GenerateToken()
+		updates := map[string]interface{}{
+			"password":   string(hashedPassword),
+			"updated_at": time.Now(),
+		}
+
+		u, err := repository.PartialUpdateUser(c.Request.Context(), oneTimeToken.UserId, updates)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Save token
-		err = SavePasswordResetToken(c.Request.Context(), user, token)
+		// Revoke every token issued before the reset
+		_, err = repository.IncrementTokenVersion(c.Request.Context(), u.Id)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		// Send reset password email
-		err = SendResetPasswordEmail(s, user, token)
+		err = repository.RevokeUserSessions(c.Request.Context(), u.Id, "")
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		RecordAudit(c, models.AuditActionPasswordReset, models.AuditOutcomeSuccess, u.Id, u.Id, nil)
+
 		data := map[string]interface{}{
-			"email":   user.Email,
-			"message": "A password reset link has been sent to your email address. Please follow the link to reset your password.",
+			"email":   u.Email,
+			"message": "Your password has been changed successfully.",
 		}
+
 		HandleSuccess(c, http.StatusOK, "ok", data)
 	}
 }
 
-func ChangePasswordHandler(s server.Server) gin.HandlerFunc {
+// UpdatePasswordHandler handles the password change of the authenticated user
+func UpdatePasswordHandler(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var request = ChangePasswordRequest{}
+		tokenString := middleware.GetTokenString(c)
 
-		err := c.BindJSON(&request)
+		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
+		if err != nil {
+			HandleError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var request = UpdatePasswordRequest{}
+
+		err = c.BindJSON(&request)
 		if err != nil {
 			HandleError(c, http.StatusBadRequest, err)
 			return
 		}
 
-		if request.Token == "" {
-			HandleError(c, http.StatusBadRequest, errors.New("token is required"))
+		if len(request.NewPassword) < MinPasswordLength {
+			HandleError(c, http.StatusBadRequest, fmt.Errorf("password must be at least %d characters long", MinPasswordLength))
 			return
 		}
 
-		user, err := repository.GetUserByPasswordResetToken(c.Request.Context(), request.Token)
+		user, err := repository.GetUserById(c.Request.Context(), claims.UserId)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
 		if user == nil {
-			HandleError(c, http.StatusUnauthorized, errors.New("token expired or invalid"))
+			HandleError(c, http.StatusNotFound, errors.New("user not found"))
 			return
 		}
 
-		if time.Now().After(user.PasswordResetTokenExpiry) {
-			HandleError(c, http.StatusUnauthorized, errors.New("token expired or invalid"))
+		if user.Password != "" {
+			// Accounts with a password must confirm the current one
+			if err = ComparePassword(request.CurrentPassword, user.Password); err != nil {
+				RecordAudit(c, models.AuditActionPasswordChange, models.AuditOutcomeFailure, "", user.Id, map[string]interface{}{
+					"reason": "invalid_password",
+				})
+				HandleError(c, http.StatusUnauthorized, err)
+				return
+			}
+		} else if time.Since(time.Unix(claims.IssuedAt, 0)) > ReauthenticationWindow {
+			// Accounts without a password must have logged in recently
+			RecordAudit(c, models.AuditActionPasswordChange, models.AuditOutcomeFailure, "", user.Id, map[string]interface{}{
+				"reason": "reauthentication_required",
+			})
+			HandleError(c, http.StatusUnauthorized, errors.New("recent authentication required"))
 			return
 		}
 
-		hashedPassword, err := utils.HashPassword(request.Password)
+		hashedPassword, err := utils.HashPassword(request.NewPassword)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		user.Password = string(hashedPassword)
+		updates := map[string]interface{}{
+			"password":   string(hashedPassword),
+			"updated_at": time.Now(),
+		}
+
+		user, err = repository.PartialUpdateUser(c.Request.Context(), user.Id, updates)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
 
-		u, err := repository.UpdateUser(c.Request.Context(), user.Id, user)
+		// Revoke every other session and issue a new token for this one
+		user.TokenVersion, err = repository.IncrementTokenVersion(c.Request.Context(), user.Id)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		err = DestroyPasswordResetToken(c.Request.Context(), u)
+		err = repository.RevokeUserSessions(c.Request.Context(), user.Id, claims.SessionId)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		token, err := GenerateUserToken(s, user, claims.SessionId, claims.OrgId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionPasswordChange, models.AuditOutcomeSuccess, "", user.Id, nil)
+
+		if s.Config().CookieMode {
+			setCookie(c, s, middleware.AccessTokenCookie, token, "/", int(AccessTokenTTL.Seconds()), true)
+			token = ""
+		}
+
+		// The password is already changed, a failed notification must not undo it
+		err = SendPasswordChangedEmail(s, user)
+		if err != nil {
+			log.Println(err)
+		}
+
 		data := map[string]interface{}{
-			"email":   user.Email,
+			"token":   token,
 			"message": "Your password has been changed successfully.",
 		}
 
+		if token == "" {
+			delete(data, "token")
+		}
+
 		HandleSuccess(c, http.StatusOK, "ok", data)
 	}
 }
@@ -303,7 +533,7 @@ func ChangePasswordHandler(s server.Server) gin.HandlerFunc {
 func LoginHandler(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var request = SignUpLoginRequest{}
-		var userRq = models.UserResponse{}
+		var user *models.User
 
 		err := c.BindJSON(&request)
 		if err != nil {
@@ -313,48 +543,109 @@ func LoginHandler(s server.Server) gin.HandlerFunc {
 
 		if request.SsoType == "google" {
 			// Login with google
-			user, err := HandleGoogleLogin(c, s, &request)
+			user, err = HandleGoogleLogin(c, s, &request)
 			if err != nil {
+				RecordAudit(c, models.AuditActionLogin, models.AuditOutcomeFailure, "", "", map[string]interface{}{
+					"method": "google",
+					"reason": "sso_failed",
+				})
 				HandleError(c, http.StatusInternalServerError, err)
 				return
 			}
-
-			userRq = *GetUserResponse(user)
 		} else {
 			// Login with email and password
-			user, err := HandleEmailAndPasswordLogin(c, &request)
+			user, err = HandleEmailAndPasswordLogin(c, &request)
+			if errors.Is(err, ErrInvalidCredentials) {
+				RecordAudit(c, models.AuditActionLogin, models.AuditOutcomeFailure, "", "", map[string]interface{}{
+					"method": "password",
+					"email":  request.Email,
+					"reason": "invalid_credentials",
+				})
+				HandleError(c, http.StatusUnauthorized, err)
+				return
+			}
+
 			if err != nil {
 				HandleError(c, http.StatusInternalServerError, err)
 				return
 			}
+		}
 
-			if user == nil {
-				HandleError(c, http.StatusUnauthorized, errors.New("user not found"))
+		if !user.IsActive {
+			RecordAudit(c, models.AuditActionLogin, models.AuditOutcomeFailure, user.Id, user.Id, map[string]interface{}{
+				"reason": "account_inactive",
+			})
+			HandleError(c, http.StatusForbidden, ErrAccountDisabled)
+			return
+		}
+
+		if !user.VerifiedEmail && s.Config().EmailVerificationPolicy == config.EmailVerificationRefuse {
+			RecordAudit(c, models.AuditActionLogin, models.AuditOutcomeFailure, user.Id, user.Id, map[string]interface{}{
+				"reason": "email_not_verified",
+			})
+			HandleError(c, http.StatusForbidden, errors.New("email not verified"))
+			return
+		}
+
+		// The tokens may be scoped to an organization of the user from the start
+		if request.OrganizationId != "" {
+			err = CheckMembership(c.Request.Context(), request.OrganizationId, user.Id)
+			if errors.Is(err, ErrNotMember) {
+				HandleError(c, http.StatusForbidden, err)
 				return
 			}
 
-			userRq = *GetUserResponse(user)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		session, err := CreateSession(c, user, request.OrganizationId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
 		}
 
 		// Generate JWT token
-		claims := models.AppClaims{
-			UserId: userRq.Id,
-			Email:  userRq.Email,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(2 * time.Hour * 24).Unix(),
-			},
+		tokenString, err := GenerateUserToken(s, user, session.Id, session.OrganizationId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString([]byte(s.Config().JWTSecret))
+		refreshToken, err := IssueRefreshToken(c.Request.Context(), session)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		method := "password"
+		if request.SsoType != "" {
+			method = request.SsoType
+		}
+
+		RecordAudit(c, models.AuditActionLogin, models.AuditOutcomeSuccess, user.Id, user.Id, map[string]interface{}{
+			"method":     method,
+			"session_id": session.Id,
+		})
+
 		loginResponse := LoginResponse{
-			User:  userRq,
-			Token: tokenString,
+			User:         *GetUserResponse(user),
+			Token:        tokenString,
+			RefreshToken: refreshToken,
+		}
+
+		// Browser clients get the tokens in cookies, out of reach of scripts
+		if s.Config().CookieMode {
+			err = SetAuthCookies(c, s, tokenString, refreshToken)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			loginResponse.Token = ""
+			loginResponse.RefreshToken = ""
 		}
 
 		HandleSuccess(c, http.StatusOK, "ok", loginResponse)
@@ -364,7 +655,7 @@ func LoginHandler(s server.Server) gin.HandlerFunc {
 // MeHandler handles the me request
 func MeHandler(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
+		tokenString := middleware.GetTokenString(c)
 
 		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
 		if err != nil {
@@ -372,27 +663,42 @@ func MeHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
-		user, err := s.Redis().GetUser(claims.UserId)
+		// The profile is cached until a write to the user drops it
+		key, err := s.Redis().Key(cache.NamespaceProfiles, claims.UserId)
 		if err != nil {
 			log.Println(err)
 		}
 
-		if user == nil {
-			user, err := repository.GetUserById(c.Request.Context(), claims.UserId)
-			if err != nil {
-				HandleError(c, http.StatusInternalServerError, err)
+		if key != "" {
+			user, err := s.Redis().GetUser(key)
+			if err == nil {
+				HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
 				return
 			}
 
-			err = s.Redis().SetUser(user.Id, user)
-			if err != nil {
+			if !cache.IsMiss(err) {
 				log.Println(err)
 			}
+		}
 
-			HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
+		user, err := repository.GetUserById(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		if user == nil {
+			HandleError(c, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		if key != "" {
+			err = s.Redis().SetUser(key, user)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
 		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
 	}
 }
@@ -400,7 +706,7 @@ func MeHandler(s server.Server) gin.HandlerFunc {
 // UpdateUserHandler handles the update user request
 func UpdateUserHandler(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
+		tokenString := middleware.GetTokenString(c)
 
 		claims, err := DecodeToken(tokenString, s.Config().JWTSecret)
 		if err != nil {
@@ -416,21 +722,90 @@ func UpdateUserHandler(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		current, err := repository.GetUserById(c.Request.Context(), claims.UserId)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if current == nil {
+			HandleError(c, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		// The email is never written here, it must be confirmed from the new address
+		changeEmail := request.Email != "" && request.Email != current.Email
+		if changeEmail {
+			if !utils.ValidateEmail(request.Email) {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid email"))
+				return
+			}
+
+			existing, err := repository.GetUserByEmail(c.Request.Context(), request.Email)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if existing != nil {
+				HandleError(c, http.StatusConflict, ErrEmailInUse)
+				return
+			}
+
+			// A new change would replace the link reverting the last one
+			emailChange, err := repository.GetEmailChangeByUserId(c.Request.Context(), current.Id)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			if emailChange != nil && emailChange.Revertible() {
+				HandleError(c, http.StatusConflict, errors.New("the last email change can still be reverted, try again later"))
+				return
+			}
+		}
+
 		updates := map[string]interface{}{
 			"first_name":   request.FirstName,
 			"last_name":    request.LastName,
 			"username":     request.Username,
-			"email":        request.Email,
 			"phone_number": request.PhoneNumber,
 			"address":      request.Address,
 		}
 
-		user, err := repository.PartialUpdateUser(c.Request.Context(), claims.UserId, updates)
+		if request.Locale != "" {
+			locale := mailer.SupportedLocale(request.Locale)
+			if locale == "" {
+				HandleError(c, http.StatusBadRequest, errors.New("unsupported locale"))
+				return
+			}
+
+			updates["locale"] = locale
+		}
+
+		user, err := UpdateUser(c.Request.Context(), claims.UserId, updates, models.EventUserUpdated)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		RecordAudit(c, models.AuditActionUserUpdate, models.AuditOutcomeSuccess, "", user.Id, nil)
+
+		if changeEmail {
+			err = RequestEmailChange(c.Request.Context(), s, user, request.Email)
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+
+			RecordAudit(c, models.AuditActionEmailChangeRequest, models.AuditOutcomeSuccess, "", user.Id, map[string]interface{}{
+				"new_email": request.Email,
+			})
+
+			HandleSuccess(c, http.StatusOK, "a confirmation link has been sent to the new email address", GetUserResponse(user))
+			return
+		}
+
 		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
 	}
 }
@@ -483,55 +858,213 @@ func UploadPictureHandler(s server.Server) gin.HandlerFunc {
 			"updated_at": time.Now(),
 		}
 
-		user, err = repository.PartialUpdateUser(c.Request.Context(), id, updates)
+		user, err = UpdateUser(c.Request.Context(), id, updates, models.EventUserUpdated)
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		RecordAudit(c, models.AuditActionUserUpdate, models.AuditOutcomeSuccess, "", id, map[string]interface{}{
+			"picture": fileUrl,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", GetUserResponse(user))
 	}
 }
 
-// ListUserHandler handles the list user request
-func ListUserHandler(s server.Server) gin.HandlerFunc {
-	return func(c *gin.Context) {
+// userSortFields are the fields the users listing can be sorted by
+var userSortFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"email":      true,
+	"username":   true,
+	"first_name": true,
+	"last_name":  true,
+}
 
-		limit := c.Query("limit")
-		offset := c.Query("offset")
+// Page sizes of the users listing
+const (
+	DefaultUserLimit = 100
+	MaxUserLimit     = 200
+)
 
-		if limit == "" {
-			limit = "100"
+type ListUserResponse struct {
+	Users      []*models.UserResponse `json:"users"`
+	Total      int                    `json:"total"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// parseUserFilter reads the users listing criteria from the query string
+func parseUserFilter(c *gin.Context) (*models.UserFilter, error) {
+	filter := models.UserFilter{
+		Search: strings.TrimSpace(c.Query("q")),
+		Role:   c.Query("role"),
+	}
+
+	for key, target := range map[string]**bool{
+		"is_active":      &filter.IsActive,
+		"verified_email": &filter.VerifiedEmail,
+	} {
+		if value := c.Query(key); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+
+			*target = &b
 		}
+	}
 
-		if offset == "" {
-			offset = "1"
+	var err error
+
+	if from := c.Query("created_from"); from != "" {
+		filter.CreatedFrom, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.New("invalid created_from")
 		}
+	}
+
+	if to := c.Query("created_to"); to != "" {
+		filter.CreatedTo, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.New("invalid created_to")
+		}
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			field = strings.TrimSpace(field)
 
-		limitInt, _ := strconv.Atoi(limit)
-		offsetInt, _ := strconv.Atoi(offset)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
 
-		users, err := s.Redis().GetUsers("users")
+			if !userSortFields[field] {
+				return nil, fmt.Errorf("invalid sort field %q", field)
+			}
+
+			filter.Sort = append(filter.Sort, models.UserSort{Field: field, Desc: desc})
+		}
+	}
+
+	if len(filter.Sort) == 0 {
+		filter.Sort = []models.UserSort{{Field: "created_at", Desc: true}}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		filter.Cursor, err = utils.DecodeKeysetCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(filter.Cursor) != len(filter.Sort)+1 {
+			return nil, utils.ErrInvalidCursor
+		}
+
+		for i, sort := range filter.Sort {
+			if sort.Field == "created_at" || sort.Field == "updated_at" {
+				if _, err = time.Parse(time.RFC3339Nano, filter.Cursor[i]); err != nil {
+					return nil, utils.ErrInvalidCursor
+				}
+			}
+		}
+	}
+
+	return &filter, nil
+}
+
+// userCursor returns the cursor of the position of a user in the listing
+func userCursor(u *models.User, sorts []models.UserSort) string {
+	values := []string{}
+
+	for _, sort := range sorts {
+		switch sort.Field {
+		case "created_at":
+			values = append(values, u.CreatedAt.UTC().Format(time.RFC3339Nano))
+		case "updated_at":
+			values = append(values, u.UpdatedAt.UTC().Format(time.RFC3339Nano))
+		case "email":
+			values = append(values, u.Email)
+		case "username":
+			values = append(values, u.Username)
+		case "first_name":
+			values = append(values, u.FirstName)
+		case "last_name":
+			values = append(values, u.LastName)
+		}
+	}
+
+	return utils.EncodeKeysetCursor(append(values, u.Id)...)
+}
+
+// ListUserHandler handles the list user request. Results can be searched
+// with q across the name, email and username, filtered by role, is_active,
+// verified_email and a created_from/created_to RFC 3339 time range, and
+// sorted by a comma separated list of fields, descending when prefixed
+// with a minus sign. Results are paginated with the next_cursor of the
+// previous page
+func ListUserHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseUserFilter(c)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		filter.Limit, err = ParseLimit(c, DefaultUserLimit, MaxUserLimit)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// One extra row tells whether there is a next page
+		limit := filter.Limit
+		filter.Limit++
+
+		// Each query is cached apart, a write to any user drops them all
+		key, err := s.Redis().Key(cache.NamespaceUsers, "list", c.Request.URL.Query().Encode())
 		if err != nil {
 			log.Println(err)
 		}
 
-		if users == nil {
-			users, err := repository.ListUser(c.Request.Context(), limitInt, offsetInt)
-			if err != nil {
-				HandleError(c, http.StatusInternalServerError, err)
+		if key != "" {
+			var response ListUserResponse
+
+			err = s.Redis().GetObject(key, &response)
+			if err == nil {
+				HandleSuccess(c, http.StatusOK, "ok", response)
 				return
 			}
 
-			err = s.Redis().SetUsers("users", users)
-			if err != nil {
+			if !cache.IsMiss(err) {
 				log.Println(err)
 			}
+		}
 
-			HandleSuccess(c, http.StatusOK, "ok", GetUsersResponse(users))
+		users, total, err := repository.ListUser(c.Request.Context(), filter)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
-		HandleSuccess(c, http.StatusOK, "ok", GetUsersResponse(users))
+		response := ListUserResponse{Total: total}
+		if len(users) > limit {
+			users = users[:limit]
+			last := users[limit-1]
+			response.NextCursor = userCursor(last, filter.Sort)
+		}
+
+		response.Users = GetUsersResponse(users)
+		if response.Users == nil {
+			response.Users = []*models.UserResponse{}
+		}
+
+		if key != "" {
+			err = s.Redis().SetValue(key, response)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", response)
 	}
 }
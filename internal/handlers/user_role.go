@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/events"
+	"github.com/tapiaw38/auth-api/internal/middleware"
 	"github.com/tapiaw38/auth-api/internal/models"
 	"github.com/tapiaw38/auth-api/internal/repository"
 	"github.com/tapiaw38/auth-api/internal/server"
@@ -14,6 +18,70 @@ type UserRoleRequest struct {
 	RoleId string `json:"role_id"`
 }
 
+// checkUserRoleChange aborts the request unless the caller may grant or
+// revoke the role of the user. Only a superadmin may grant or revoke the
+// superadmin role, or change the roles of another superadmin
+func checkUserRoleChange(c *gin.Context, userId string, roleId string) bool {
+	role, err := repository.GetRoleById(c.Request.Context(), roleId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if role == nil {
+		HandleError(c, http.StatusBadRequest, errors.New("role not found"))
+		return false
+	}
+
+	user, err := repository.GetUserById(c.Request.Context(), userId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if user == nil {
+		HandleError(c, http.StatusNotFound, errors.New("user not found"))
+		return false
+	}
+
+	value, _ := c.Get(middleware.ClaimsKey)
+	claims, _ := value.(*models.AppClaims)
+
+	callerId := ""
+	if claims != nil {
+		callerId = claims.UserId
+	}
+
+	return checkRoleGrant(c, callerId, role, user)
+}
+
+// checkRoleGrant aborts the request unless the granter may grant the role
+// to the user, nil for a user yet to be created. Only a superadmin may grant
+// the superadmin role, or change the roles of another superadmin
+func checkRoleGrant(c *gin.Context, granterId string, role *models.Role, user *models.User) bool {
+	if role.Name != "superadmin" && (user == nil || !user.HasRole("superadmin")) {
+		return true
+	}
+
+	if granterId == "" {
+		HandleError(c, http.StatusForbidden, errors.New("forbidden"))
+		return false
+	}
+
+	granter, err := repository.GetUserById(c.Request.Context(), granterId)
+	if err != nil {
+		HandleError(c, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if granter == nil || !granter.HasRole("superadmin") {
+		HandleError(c, http.StatusForbidden, errors.New("forbidden"))
+		return false
+	}
+
+	return true
+}
+
 // InsertUserRole is the handler for the InsertUserRole endpoint
 func InsertUserRole(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -25,17 +93,35 @@ func InsertUserRole(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		if !checkUserRoleChange(c, request.UserId, request.RoleId) {
+			return
+		}
+
 		var userRole = models.UserRole{
 			UserId: request.UserId,
 			RoleId: request.RoleId,
 		}
 
-		err = repository.InsertUserRole(c.Request.Context(), &userRole)
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			err := repository.InsertUserRole(ctx, &userRole)
+			if err != nil {
+				return err
+			}
+
+			return events.Publish(ctx, models.EventRoleGranted, &models.RoleEventPayload{
+				UserId: userRole.UserId,
+				RoleId: userRole.RoleId,
+			})
+		})
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		RecordAudit(c, models.AuditActionRoleGrant, models.AuditOutcomeSuccess, "", userRole.UserId, map[string]interface{}{
+			"role_id": userRole.RoleId,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", nil)
 	}
 }
@@ -51,17 +137,35 @@ func DeleteUserRole(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		if !checkUserRoleChange(c, request.UserId, request.RoleId) {
+			return
+		}
+
 		userRole := models.UserRole{
 			UserId: request.UserId,
 			RoleId: request.RoleId,
 		}
 
-		err = repository.DeleteUserRole(c.Request.Context(), &userRole)
+		err = repository.WithTx(c.Request.Context(), func(ctx context.Context) error {
+			err := repository.DeleteUserRole(ctx, &userRole)
+			if err != nil {
+				return err
+			}
+
+			return events.Publish(ctx, models.EventRoleRevoked, &models.RoleEventPayload{
+				UserId: userRole.UserId,
+				RoleId: userRole.RoleId,
+			})
+		})
 		if err != nil {
 			HandleError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		RecordAudit(c, models.AuditActionRoleRevoke, models.AuditOutcomeSuccess, "", userRole.UserId, map[string]interface{}{
+			"role_id": userRole.RoleId,
+		})
+
 		HandleSuccess(c, http.StatusOK, "ok", nil)
 	}
 }
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+	"github.com/tapiaw38/auth-api/internal/server"
+	"github.com/tapiaw38/auth-api/internal/utils"
+	"github.com/tapiaw38/auth-api/internal/webhooks"
+)
+
+type WebhookRequest struct {
+	Url        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	IsActive   *bool    `json:"is_active"`
+}
+
+// Page sizes of the webhook delivery history
+const (
+	DefaultWebhookDeliveryLimit = 50
+	MaxWebhookDeliveryLimit     = 200
+)
+
+// validateWebhook checks the url and event types of a webhook
+func validateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if err := webhooks.ValidateURL(ctx, webhook.Url); err != nil {
+		return err
+	}
+
+	if len(webhook.EventTypes) == 0 {
+		return errors.New("event types are required")
+	}
+
+	for _, eventType := range webhook.EventTypes {
+		known := false
+		for _, t := range models.EventTypes {
+			known = known || t == eventType
+		}
+
+		if !known {
+			return errors.New("unknown event type " + eventType)
+		}
+	}
+
+	return nil
+}
+
+// GetWebhookResponse returns a webhook without its secret
+func GetWebhookResponse(webhook *models.Webhook) *models.Webhook {
+	response := *webhook
+	response.Secret = ""
+
+	return &response
+}
+
+// InsertWebhookHandler handles the insert webhook request, the secret is
+// generated when none is given and only returned in this response
+func InsertWebhookHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = WebhookRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		webhook := models.Webhook{
+			Id:         id.String(),
+			Url:        request.Url,
+			Secret:     request.Secret,
+			EventTypes: request.EventTypes,
+			IsActive:   request.IsActive == nil || *request.IsActive,
+		}
+
+		if err = validateWebhook(c.Request.Context(), &webhook); err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if webhook.Secret == "" {
+			webhook.Secret, err = utils.GenerateToken()
+			if err != nil {
+				HandleError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		wh, err := repository.InsertWebhook(c.Request.Context(), &webhook)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionWebhookCreate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"webhook_id":  wh.Id,
+			"url":         wh.Url,
+			"event_types": wh.EventTypes,
+		})
+
+		HandleSuccess(c, http.StatusCreated, "ok", wh)
+	}
+}
+
+// ListWebhookHandler handles the list webhook request
+func ListWebhookHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhooks, err := repository.ListWebhook(c.Request.Context())
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := []*models.Webhook{}
+		for _, webhook := range webhooks {
+			response = append(response, GetWebhookResponse(webhook))
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", response)
+	}
+}
+
+// GetWebhookByIdHandler handles the get webhook by id request
+func GetWebhookByIdHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhook, err := repository.GetWebhookById(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if webhook == nil {
+			HandleError(c, http.StatusNotFound, errors.New("webhook not found"))
+			return
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", GetWebhookResponse(webhook))
+	}
+}
+
+// UpdateWebhookHandler handles the update webhook request, only the given
+// fields are changed and a new secret rotates the signing key
+func UpdateWebhookHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request = WebhookRequest{}
+
+		err := c.BindJSON(&request)
+		if err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		webhook, err := repository.GetWebhookById(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if webhook == nil {
+			HandleError(c, http.StatusNotFound, errors.New("webhook not found"))
+			return
+		}
+
+		if request.Url != "" {
+			webhook.Url = request.Url
+		}
+
+		if request.Secret != "" {
+			webhook.Secret = request.Secret
+		}
+
+		if request.EventTypes != nil {
+			webhook.EventTypes = request.EventTypes
+		}
+
+		if request.IsActive != nil {
+			webhook.IsActive = *request.IsActive
+		}
+
+		if err = validateWebhook(c.Request.Context(), webhook); err != nil {
+			HandleError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		wh, err := repository.UpdateWebhook(c.Request.Context(), webhook)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionWebhookUpdate, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"webhook_id":     wh.Id,
+			"url":            wh.Url,
+			"event_types":    wh.EventTypes,
+			"is_active":      wh.IsActive,
+			"secret_rotated": request.Secret != "",
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", GetWebhookResponse(wh))
+	}
+}
+
+// DeleteWebhookHandler handles the delete webhook request
+func DeleteWebhookHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		webhook, err := repository.GetWebhookById(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if webhook == nil {
+			HandleError(c, http.StatusNotFound, errors.New("webhook not found"))
+			return
+		}
+
+		err = repository.DeleteWebhook(c.Request.Context(), id)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionWebhookDelete, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"webhook_id": id,
+			"url":        webhook.Url,
+		})
+
+		HandleSuccess(c, http.StatusOK, "ok", nil)
+	}
+}
+
+// ListWebhookDeliveryHandler handles the delivery history request of a webhook
+func ListWebhookDeliveryHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := DefaultWebhookDeliveryLimit
+
+		if value := c.Query("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > MaxWebhookDeliveryLimit {
+				HandleError(c, http.StatusBadRequest, errors.New("invalid limit"))
+				return
+			}
+		}
+
+		deliveries, err := repository.ListWebhookDelivery(c.Request.Context(), c.Param("id"), limit)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []*models.WebhookDelivery{}
+		}
+
+		HandleSuccess(c, http.StatusOK, "ok", deliveries)
+	}
+}
+
+// RedeliverWebhookHandler queues a delivery again, whatever its status
+func RedeliverWebhookHandler(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delivery, err := repository.GetWebhookDeliveryById(c.Request.Context(), c.Param("delivery_id"))
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if delivery == nil || delivery.WebhookId != c.Param("id") {
+			HandleError(c, http.StatusNotFound, errors.New("delivery not found"))
+			return
+		}
+
+		err = webhooks.Redeliver(c.Request.Context(), delivery)
+		if err != nil {
+			HandleError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		RecordAudit(c, models.AuditActionWebhookRedeliver, models.AuditOutcomeSuccess, "", "", map[string]interface{}{
+			"webhook_id":  delivery.WebhookId,
+			"delivery_id": delivery.Id,
+			"event_id":    delivery.EventId,
+		})
+
+		HandleSuccess(c, http.StatusAccepted, "ok", nil)
+	}
+}
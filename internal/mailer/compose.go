@@ -0,0 +1,251 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Message is an email before composition
+type Message struct {
+	From    mail.Address
+	To      mail.Address
+	Subject string
+	Text    string
+	HTML    string
+	// ListUnsubscribe holds the mailto: and https: unsubscribe URIs
+	ListUnsubscribe []string
+	// Inline are the images referenced from the HTML part as cid:<ContentID>
+	Inline []InlineImage
+	// Date defaults to now
+	Date time.Time
+}
+
+// InlineImage is an image embedded in the HTML part
+type InlineImage struct {
+	ContentID   string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Header is a header of a composed email, in the order it was written
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Composed is an RFC 5322 email ready to be sent
+type Composed struct {
+	MessageId string
+	Headers   []Header
+	Raw       []byte
+}
+
+// Compose builds a multipart/alternative email with the text and HTML
+// parts, wrapped in multipart/related when there are inline images
+func Compose(msg *Message) (*Composed, error) {
+	if msg.From.Address == "" || msg.To.Address == "" {
+		return nil, errors.New("sender and recipient are required")
+	}
+
+	if msg.Text == "" && msg.HTML == "" {
+		return nil, errors.New("text or html body is required")
+	}
+
+	date := msg.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	messageId, err := newMessageId(msg.From.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []Header{
+		{"Date", date.Format(time.RFC1123Z)},
+		{"Message-ID", messageId},
+		{"MIME-Version", "1.0"},
+		{"From", msg.From.String()},
+		{"To", msg.To.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+	}
+
+	if len(msg.ListUnsubscribe) > 0 {
+		uris := make([]string, len(msg.ListUnsubscribe))
+		for i, uri := range msg.ListUnsubscribe {
+			uris[i] = "<" + uri + ">"
+		}
+		headers = append(headers, Header{"List-Unsubscribe", strings.Join(uris, ", ")})
+	}
+
+	body := &bytes.Buffer{}
+
+	contentType, err := writeBody(body, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	headers = append(headers, Header{"Content-Type", contentType})
+
+	raw := &bytes.Buffer{}
+	for _, h := range headers {
+		raw.WriteString(h.Key + ": " + h.Value + "\r\n")
+	}
+	raw.WriteString("\r\n")
+	raw.Write(body.Bytes())
+
+	return &Composed{
+		MessageId: messageId,
+		Headers:   headers,
+		Raw:       raw.Bytes(),
+	}, nil
+}
+
+// writeBody writes the MIME body and returns its content type
+func writeBody(w *bytes.Buffer, msg *Message) (string, error) {
+	if len(msg.Inline) == 0 {
+		return writeAlternative(w, msg)
+	}
+
+	related := multipart.NewWriter(w)
+
+	alternative := &bytes.Buffer{}
+	contentType, err := writeAlternative(alternative, msg)
+	if err != nil {
+		return "", err
+	}
+
+	part, err := related.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = part.Write(alternative.Bytes()); err != nil {
+		return "", err
+	}
+
+	for _, image := range msg.Inline {
+		if err = writeInline(related, image); err != nil {
+			return "", err
+		}
+	}
+
+	if err = related.Close(); err != nil {
+		return "", err
+	}
+
+	return mime.FormatMediaType("multipart/related", map[string]string{
+		"type":     "multipart/alternative",
+		"boundary": related.Boundary(),
+	}), nil
+}
+
+// writeAlternative writes the text and HTML parts, the last part is the
+// preferred one
+func writeAlternative(w *bytes.Buffer, msg *Message) (string, error) {
+	alternative := multipart.NewWriter(w)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err = qp.Write([]byte(p.content)); err != nil {
+			return "", err
+		}
+
+		if err = qp.Close(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := alternative.Close(); err != nil {
+		return "", err
+	}
+
+	return mime.FormatMediaType("multipart/alternative", map[string]string{
+		"boundary": alternative.Boundary(),
+	}), nil
+}
+
+// writeInline writes an inline image as a base64 part
+func writeInline(w *multipart.Writer, image InlineImage) error {
+	if image.ContentID == "" || image.ContentType == "" {
+		return errors.New("inline image content id and type are required")
+	}
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {image.ContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-ID":                {"<" + image.ContentID + ">"},
+		"Content-Disposition":       {"inline"},
+	}
+
+	if image.Filename != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+			"filename": image.Filename,
+		}))
+	}
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// Encoded lines must not exceed 76 characters
+	encoded := base64.StdEncoding.EncodeToString(image.Data)
+	for len(encoded) > 76 {
+		if _, err = part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err = part.Write([]byte(encoded + "\r\n"))
+
+	return err
+}
+
+// newMessageId returns a unique Message-ID in the domain of the sender
+func newMessageId(from string) (string, error) {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("<%s@%s>", id.String(), domain), nil
+}
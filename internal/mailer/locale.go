@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the locale of the users without a preference, and the
+// last fallback of every locale
+const DefaultLocale = "es"
+
+// localeRegexp matches the locales, which are also directory names
+var localeRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z0-9]{2,8})*$`)
+
+// NormalizeLocale returns a locale in its canonical form, e.g. es-AR
+func NormalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i])
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// Locales returns the locales having a templates directory
+func Locales() []string {
+	entries, err := fs.ReadDir(Defaults, ".")
+	if err != nil {
+		return []string{DefaultLocale}
+	}
+
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			locales = append(locales, entry.Name())
+		}
+	}
+
+	return locales
+}
+
+// SupportedLocale returns the closest locale having a templates directory,
+// e.g. es for es-AR, or an empty string when there is none
+func SupportedLocale(locale string) string {
+	locale = NormalizeLocale(locale)
+	if !localeRegexp.MatchString(locale) {
+		return ""
+	}
+
+	base := strings.SplitN(locale, "-", 2)[0]
+
+	var match string
+	for _, l := range Locales() {
+		if l == locale {
+			return l
+		}
+
+		if l == base {
+			match = l
+		}
+	}
+
+	return match
+}
+
+// MatchLocale returns the supported locale preferred by an Accept-Language
+// header, or the default locale
+func MatchLocale(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(item, ";")
+
+		tag := strings.TrimSpace(params[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	for _, t := range tags {
+		if locale := SupportedLocale(t.tag); locale != "" {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
+
+// fallbackLocales returns the locales to look up for a locale, from the
+// most to the least specific: es-AR, es, then the default locale
+func fallbackLocales(locale string) []string {
+	locale = NormalizeLocale(locale)
+
+	var locales []string
+	add := func(l string) {
+		if !localeRegexp.MatchString(l) {
+			return
+		}
+
+		for _, existing := range locales {
+			if existing == l {
+				return
+			}
+		}
+
+		locales = append(locales, l)
+	}
+
+	add(locale)
+	add(strings.SplitN(locale, "-", 2)[0])
+	add(DefaultLocale)
+
+	return locales
+}
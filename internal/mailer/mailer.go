@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// Email drivers
+const (
+	DriverSMTP    = "smtp"
+	DriverMailgun = "mailgun"
+	DriverFile    = "file"
+	DriverLog     = "log"
+)
+
+// SMTP connection security
+const (
+	SecurityTLS      = "tls"
+	SecurityStartTLS = "starttls"
+)
+
+// SendTimeout bounds the delivery of an email when the context has no deadline
+const SendTimeout = 30 * time.Second
+
+// EmailSender delivers a rendered email message
+type EmailSender interface {
+	SendEmail(ctx context.Context, msg *models.EmailMessage) error
+}
+
+// Config is the configuration of the email drivers
+type Config struct {
+	Driver    string
+	SMTP      SMTPConfig
+	Mailgun   MailgunConfig
+	OutboxDir string
+}
+
+// New returns the email sender of the configured driver, SMTP by default.
+// Emails are only logged with the log driver, which must be chosen explicitly
+func New(config *Config) (EmailSender, error) {
+	switch config.Driver {
+	case DriverSMTP, "":
+		return NewSMTPSender(&config.SMTP)
+	case DriverMailgun:
+		return NewMailgunSender(&config.Mailgun)
+	case DriverFile:
+		return NewFileSender(config.OutboxDir)
+	case DriverLog:
+		return NewLogSender(), nil
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", config.Driver)
+	}
+}
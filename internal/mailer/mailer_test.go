@@ -0,0 +1,403 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("should select the configured driver", func(t *testing.T) {
+		sender, err := New(&Config{Driver: DriverLog})
+		assert.NoError(t, err)
+		assert.IsType(t, &LogSender{}, sender)
+
+		sender, err = New(&Config{Driver: DriverSMTP, SMTP: SMTPConfig{Host: "smtp.example.com", Port: "465"}})
+		assert.NoError(t, err)
+		assert.Equal(t, SecurityTLS, sender.(*SMTPSender).config.Security)
+
+		sender, err = New(&Config{Driver: DriverSMTP, SMTP: SMTPConfig{Host: "smtp.example.com", Port: "587"}})
+		assert.NoError(t, err)
+		assert.Equal(t, SecurityStartTLS, sender.(*SMTPSender).config.Security)
+	})
+
+	t.Run("should only log emails with the explicit log driver", func(t *testing.T) {
+		_, err := New(&Config{})
+		assert.Error(t, err)
+
+		sender, err := New(&Config{Driver: DriverLog})
+		assert.NoError(t, err)
+		assert.IsType(t, &LogSender{}, sender)
+	})
+
+	t.Run("should fail on a missing configuration", func(t *testing.T) {
+		_, err := New(&Config{Driver: DriverMailgun})
+		assert.Error(t, err)
+
+		_, err = New(&Config{Driver: "pigeon"})
+		assert.Error(t, err)
+	})
+}
+
+func TestFileSender(t *testing.T) {
+	dir := t.TempDir()
+
+	sender, err := NewFileSender(dir)
+	assert.NoError(t, err)
+
+	err = sender.SendEmail(context.Background(), &models.EmailMessage{
+		To:   "to@example.com",
+		From: "from@example.com",
+		Body: "Subject: Hello\r\n\r\nHello",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	body, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "Subject: Hello\r\n\r\nHello", string(body))
+}
+
+func TestSMTPSender(t *testing.T) {
+	t.Run("should refuse a server without STARTTLS", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+
+		// A plain text server that never offers STARTTLS
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			r := bufio.NewReader(conn)
+			conn.Write([]byte("220 localhost ESMTP\r\n"))
+
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				switch strings.ToUpper(strings.Fields(line)[0]) {
+				case "EHLO":
+					conn.Write([]byte("250-localhost\r\n250 AUTH PLAIN\r\n"))
+				case "QUIT":
+					conn.Write([]byte("221 bye\r\n"))
+					return
+				default:
+					conn.Write([]byte("250 ok\r\n"))
+				}
+			}
+		}()
+
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+		sender, err := NewSMTPSender(&SMTPConfig{
+			Host:         host,
+			Port:         port,
+			HostUser:     "user",
+			HostPassword: "secret",
+			Security:     SecurityStartTLS,
+		})
+		assert.NoError(t, err)
+
+		err = sender.SendEmail(context.Background(), &models.EmailMessage{
+			To:   "to@example.com",
+			From: "from@example.com",
+			Body: "Hello",
+		})
+		assert.EqualError(t, err, "smtp server does not support STARTTLS")
+	})
+}
+
+func TestCompose(t *testing.T) {
+	msg := &Message{
+		From:            mail.Address{Name: "Mi Tour", Address: "no-reply@example.com"},
+		To:              mail.Address{Address: "to@example.com"},
+		Subject:         "Restablecer contraseña",
+		Text:            "Hola, abre el enlace",
+		HTML:            `<p>Hola</p><img src="cid:logo">`,
+		ListUnsubscribe: []string{"mailto:no-reply@example.com?subject=unsubscribe"},
+	}
+
+	t.Run("should compose a multipart/alternative email", func(t *testing.T) {
+		composed, err := Compose(msg)
+		assert.NoError(t, err)
+
+		parsed, err := mail.ReadMessage(bytes.NewReader(composed.Raw))
+		assert.NoError(t, err)
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Restablecer contraseña", subject)
+		assert.NotContains(t, parsed.Header.Get("Subject"), "ñ")
+
+		assert.Equal(t, "1.0", parsed.Header.Get("MIME-Version"))
+		assert.Equal(t, composed.MessageId, parsed.Header.Get("Message-ID"))
+		assert.True(t, strings.HasSuffix(composed.MessageId, "@example.com>"))
+		assert.Equal(t, "<mailto:no-reply@example.com?subject=unsubscribe>", parsed.Header.Get("List-Unsubscribe"))
+
+		_, err = parsed.Header.Date()
+		assert.NoError(t, err)
+
+		mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/alternative", mediaType)
+
+		parts := multipart.NewReader(parsed.Body, params["boundary"])
+
+		text, err := parts.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(text)
+		assert.Equal(t, msg.Text, string(body))
+
+		html, err := parts.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(html)
+		assert.Equal(t, msg.HTML, string(body))
+	})
+
+	t.Run("should wrap inline images in multipart/related", func(t *testing.T) {
+		withImage := *msg
+		withImage.Inline = []InlineImage{{
+			ContentID:   "logo",
+			Filename:    "logo.png",
+			ContentType: "image/png",
+			Data:        bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 40),
+		}}
+
+		composed, err := Compose(&withImage)
+		assert.NoError(t, err)
+
+		parsed, err := mail.ReadMessage(bytes.NewReader(composed.Raw))
+		assert.NoError(t, err)
+
+		mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/related", mediaType)
+
+		parts := multipart.NewReader(parsed.Body, params["boundary"])
+
+		alternative, err := parts.NextPart()
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(alternative.Header.Get("Content-Type"), "multipart/alternative"))
+
+		image, err := parts.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "<logo>", image.Header.Get("Content-ID"))
+
+		encoded, _ := io.ReadAll(image)
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+		assert.NoError(t, err)
+		assert.Equal(t, withImage.Inline[0].Data, data)
+	})
+}
+
+// useTemplates replaces the default templates for the duration of a test
+func useTemplates(t *testing.T, files map[string]string) {
+	mapFS := fstest.MapFS{}
+	for name, content := range files {
+		mapFS[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	previous := Defaults
+	Defaults = mapFS
+	SetOverrides(nil)
+	resetCache()
+
+	t.Cleanup(func() {
+		Defaults = previous
+		SetOverrides(nil)
+		resetCache()
+	})
+}
+
+// resetCache drops the parsed templates and catalogs
+func resetCache() {
+	store.Lock()
+	defer store.Unlock()
+
+	store.defaults = map[string]*parsedTemplate{}
+	store.catalogs = map[string]map[string]string{}
+	store.custom = map[string]*parsedTemplate{}
+}
+
+func TestLocales(t *testing.T) {
+	useTemplates(t, map[string]string{
+		"es/welcome.html":   "<p>Hola {{.name}}</p>",
+		"es/welcome.txt":    "Hola {{.name}}",
+		"es/messages.json":  `{"welcome.subject": "Bienvenido", "bye.subject": "Adiós"}`,
+		"en/welcome.html":   "<p>Hello {{.name}}</p>",
+		"en/messages.json":  `{"welcome.subject": "Welcome"}`,
+		"pt-BR/goodbye.txt": "Tchau",
+	})
+
+	t.Run("should match the Accept-Language header", func(t *testing.T) {
+		assert.Equal(t, "en", MatchLocale("fr-CH, fr;q=0.9, en;q=0.8, es;q=0.7"))
+		assert.Equal(t, "es", MatchLocale("es-AR,en;q=0.5"))
+		assert.Equal(t, "pt-BR", MatchLocale("pt_br"))
+		assert.Equal(t, DefaultLocale, MatchLocale("de, en;q=0"))
+		assert.Equal(t, DefaultLocale, MatchLocale(""))
+	})
+
+	t.Run("should reject unsupported locales", func(t *testing.T) {
+		assert.Equal(t, "en", SupportedLocale("en-GB"))
+		assert.Equal(t, "", SupportedLocale("de"))
+		assert.Equal(t, "", SupportedLocale("../es"))
+	})
+
+	t.Run("should fall back to the closest locale", func(t *testing.T) {
+		rendered, err := Render(context.Background(), "", "en-US", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Rendered{Subject: "Welcome", HTML: "<p>Hello Ana</p>"}, rendered)
+
+		rendered, err = Render(context.Background(), "", "de", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Rendered{Subject: "Bienvenido", HTML: "<p>Hola Ana</p>", Text: "Hola Ana"}, rendered)
+
+		assert.Equal(t, "Welcome", Translate("en-US", "welcome.subject"))
+		assert.Equal(t, "Adiós", Translate("en", "bye.subject"))
+		assert.Equal(t, "missing.subject", Translate("en", "missing.subject"))
+
+		_, err = Render(context.Background(), "", "en", "missing", nil)
+		assert.ErrorIs(t, err, ErrTemplateNotFound)
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	useTemplates(t, map[string]string{
+		"es/welcome.html":  "<p>Hola {{.name}}</p>",
+		"es/messages.json": `{"welcome.subject": "Bienvenido"}`,
+		"en/welcome.html":  "<p>Hello {{.name}}</p>",
+		"en/messages.json": `{"welcome.subject": "Welcome"}`,
+	})
+
+	override := &models.EmailTemplate{
+		Name:      "welcome",
+		Locale:    "es",
+		Subject:   "Hola {{.name}}",
+		HTML:      "<p>Hola de nuevo {{.name}}</p>",
+		UpdatedAt: time.Now(),
+	}
+
+	SetOverrides(func(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+		return []*models.EmailTemplate{override}, nil
+	})
+
+	t.Run("should prefer the override of the locale", func(t *testing.T) {
+		rendered, err := Render(context.Background(), "", "es", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Rendered{Subject: "Hola Ana", HTML: "<p>Hola de nuevo Ana</p>"}, rendered)
+
+		// A default in the requested locale beats an override in a fallback
+		rendered, err = Render(context.Background(), "", "en", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>Hello Ana</p>", rendered.HTML)
+	})
+
+	t.Run("should prefer the override of the template set", func(t *testing.T) {
+		branded := &models.EmailTemplate{
+			Name:        "welcome",
+			Locale:      "es",
+			TemplateSet: "acme",
+			HTML:        "<p>Hola desde Acme {{.name}}</p>",
+			UpdatedAt:   time.Now(),
+		}
+
+		SetOverrides(func(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+			return []*models.EmailTemplate{override, branded}, nil
+		})
+		defer SetOverrides(func(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+			return []*models.EmailTemplate{override}, nil
+		})
+
+		rendered, err := Render(context.Background(), "acme", "es", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Rendered{Subject: "Bienvenido", HTML: "<p>Hola desde Acme Ana</p>"}, rendered)
+
+		// Other sets fall back to the override for every set
+		rendered, err = Render(context.Background(), "other", "es", "welcome", map[string]string{"name": "Ana"})
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>Hola de nuevo Ana</p>", rendered.HTML)
+	})
+
+	t.Run("should parse the override again when updated", func(t *testing.T) {
+		override.HTML = "<p>Actualizado</p>"
+		override.UpdatedAt = override.UpdatedAt.Add(time.Second)
+
+		rendered, err := Render(context.Background(), "", "es", "welcome", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>Actualizado</p>", rendered.HTML)
+	})
+
+	t.Run("should load the overrides again once invalidated", func(t *testing.T) {
+		loads := 0
+
+		SetOverrides(func(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+			loads++
+			return []*models.EmailTemplate{override}, nil
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := Render(context.Background(), "", "es", "welcome", nil)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 1, loads)
+
+		InvalidateOverrides("welcome")
+
+		_, err := Render(context.Background(), "", "es", "welcome", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, loads)
+	})
+
+	t.Run("should escape the variables of the HTML part", func(t *testing.T) {
+		rendered, err := RenderTemplate(&models.EmailTemplate{
+			Name:   "welcome",
+			Locale: "en",
+			HTML:   "<p>{{.name}}</p>",
+		}, map[string]string{"name": "<script>"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Rendered{Subject: "Welcome", HTML: "<p>&lt;script&gt;</p>"}, rendered)
+
+		_, err = RenderTemplate(&models.EmailTemplate{Name: "welcome", Locale: "en", HTML: "{{.name"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	names := TemplateNames()
+	assert.Contains(t, names, "reset_password")
+
+	for _, locale := range Locales() {
+		for _, name := range names {
+			rendered, err := Render(context.Background(), "", locale, name, SampleVariables(name))
+			assert.NoError(t, err, locale+"/"+name)
+			assert.NotEqual(t, name+".subject", rendered.Subject, locale+"/"+name)
+			assert.NotEmpty(t, rendered.Text, locale+"/"+name)
+		}
+	}
+}
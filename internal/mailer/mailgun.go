@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mailgun/mailgun-go/v4"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// MailgunConfig is the configuration for the Mailgun API
+type MailgunConfig struct {
+	Domain        string
+	PrivateAPIKey string
+	// APIBase overrides the API endpoint, e.g. mailgun.APIBaseEU
+	APIBase string
+}
+
+// MailgunSender sends emails through the Mailgun API
+type MailgunSender struct {
+	mg mailgun.Mailgun
+}
+
+// NewMailgunSender creates a new MailgunSender
+func NewMailgunSender(config *MailgunConfig) (*MailgunSender, error) {
+	if config.Domain == "" || config.PrivateAPIKey == "" {
+		return nil, errors.New("mailgun domain and private api key are required")
+	}
+
+	mg := mailgun.NewMailgun(config.Domain, config.PrivateAPIKey)
+	if config.APIBase != "" {
+		mg.SetAPIBase(config.APIBase)
+	}
+
+	return &MailgunSender{mg: mg}, nil
+}
+
+// SendEmail sends the message as is, it is already a complete MIME message
+func (s *MailgunSender) SendEmail(ctx context.Context, msg *models.EmailMessage) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SendTimeout)
+		defer cancel()
+	}
+
+	message := s.mg.NewMIMEMessage(io.NopCloser(strings.NewReader(msg.Body)), msg.To)
+
+	resp, id, err := s.mg.Send(ctx, message)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("mailgun accepted email %s: %s", id, resp)
+
+	return nil
+}
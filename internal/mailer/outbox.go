@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// FileSender writes every email as an .eml file into a directory instead
+// of sending it, for local development and tests
+type FileSender struct {
+	dir string
+}
+
+// NewFileSender creates a new FileSender, creating the directory if needed
+func NewFileSender(dir string) (*FileSender, error) {
+	if dir == "" {
+		return nil, errors.New("email outbox directory is required")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileSender{dir: dir}, nil
+}
+
+// SendEmail writes the message into the outbox directory
+func (s *FileSender) SendEmail(ctx context.Context, msg *models.EmailMessage) error {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	// ksuids sort by time, so do the files
+	name := filepath.Join(s.dir, id.String()+".eml")
+
+	// Write to a temporary file first so readers never see a partial email
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(msg.Body), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// LogSender logs the emails instead of sending them, for local development
+type LogSender struct{}
+
+// NewLogSender creates a new LogSender
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// SendEmail logs the message
+func (s *LogSender) SendEmail(ctx context.Context, msg *models.EmailMessage) error {
+	log.Printf("email to %s from %s:\n%s", msg.To, msg.From, strings.TrimSpace(msg.Body))
+
+	return nil
+}
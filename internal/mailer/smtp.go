@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// SMTPConfig is the configuration for the SMTP server
+type SMTPConfig struct {
+	Host         string
+	Port         string
+	HostUser     string
+	HostPassword string
+	// Security is either SecurityTLS or SecurityStartTLS, defaults to
+	// implicit TLS on port 465 and STARTTLS otherwise
+	Security string
+}
+
+// SMTPSender sends emails through an SMTP server. The server certificate
+// is always verified against the configured host
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPSender creates a new SMTPSender
+func NewSMTPSender(config *SMTPConfig) (*SMTPSender, error) {
+	if config.Host == "" || config.Port == "" {
+		return nil, errors.New("smtp host and port are required")
+	}
+
+	conf := *config
+	if conf.Security == "" {
+		conf.Security = SecurityStartTLS
+		if conf.Port == "465" {
+			conf.Security = SecurityTLS
+		}
+	}
+
+	if conf.Security != SecurityTLS && conf.Security != SecurityStartTLS {
+		return nil, fmt.Errorf("unknown smtp security %q", conf.Security)
+	}
+
+	return &SMTPSender{config: conf}, nil
+}
+
+// SendEmail sends an email
+func (s *SMTPSender) SendEmail(ctx context.Context, msg *models.EmailMessage) error {
+	host := s.config.Host
+	address := net.JoinHostPort(host, s.config.Port)
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(SendTimeout)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var conn net.Conn
+	var err error
+
+	if s.config.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The deadline also covers the SMTP conversation
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.Security == SecurityStartTLS {
+		// Never fall back to plain text, the credentials would leak
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if s.config.HostUser != "" {
+		auth := smtp.PlainAuth("", s.config.HostUser, s.config.HostPassword, host)
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(msg.From); err != nil {
+		return err
+	}
+
+	if err = client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte(msg.Body))
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,421 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/templates"
+)
+
+// ErrTemplateNotFound is returned when no locale has the template
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// Defaults holds a directory per locale with the default email templates,
+// <name>.html and the optional plain text alternative <name>.txt, and the
+// messages.json catalog of the translated strings
+var Defaults fs.FS = templates.FS
+
+// catalogFile is the name of the message catalog of a locale
+const catalogFile = "messages.json"
+
+// OverrideFunc returns the overrides of a template in every locale
+type OverrideFunc func(ctx context.Context, name string) ([]*models.EmailTemplate, error)
+
+// OverridesTTL bounds the time the overrides of a template are cached, so
+// that the changes made through another instance are eventually seen
+const OverridesTTL = time.Minute
+
+// Rendered is an email rendered from a template
+type Rendered struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// parsedTemplate is a template ready to be executed, a nil subject uses
+// the catalog and a nil text sends the HTML part only
+type parsedTemplate struct {
+	subject   *template.Template
+	html      *htmltemplate.Template
+	text      *template.Template
+	updatedAt time.Time
+}
+
+// overrideList is the cached list of the overrides of a template
+type overrideList struct {
+	templates []*models.EmailTemplate
+	loadedAt  time.Time
+}
+
+// store caches the parsed templates and catalogs. The defaults never
+// change, the overrides are loaded again when invalidated or after
+// OverridesTTL and parsed again when updated
+var store = struct {
+	sync.RWMutex
+	overrides OverrideFunc
+	defaults  map[string]*parsedTemplate
+	catalogs  map[string]map[string]string
+	lists     map[string]*overrideList
+	custom    map[string]*parsedTemplate
+}{
+	defaults: map[string]*parsedTemplate{},
+	catalogs: map[string]map[string]string{},
+	lists:    map[string]*overrideList{},
+	custom:   map[string]*parsedTemplate{},
+}
+
+// SetOverrides sets the source of the templates overriding the defaults
+func SetOverrides(fn OverrideFunc) {
+	store.Lock()
+	defer store.Unlock()
+
+	store.overrides = fn
+	store.lists = map[string]*overrideList{}
+	store.custom = map[string]*parsedTemplate{}
+}
+
+// InvalidateOverrides drops the cached overrides of a template, to be
+// called once they are updated or deleted
+func InvalidateOverrides(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.lists, name)
+}
+
+// loadOverrides returns the overrides of a template, cached until
+// invalidated or for OverridesTTL. A failure to load them is not cached
+func loadOverrides(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+	store.RLock()
+	overrides := store.overrides
+	list, ok := store.lists[name]
+	store.RUnlock()
+
+	if overrides == nil {
+		return nil, nil
+	}
+
+	if ok && time.Since(list.loadedAt) < OverridesTTL {
+		return list.templates, nil
+	}
+
+	templates, err := overrides(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	store.Lock()
+	store.lists[name] = &overrideList{templates: templates, loadedAt: time.Now()}
+	store.Unlock()
+
+	return templates, nil
+}
+
+// Render executes the template of an email in the closest locale having
+// it. For each locale the override of the template set takes precedence
+// over the override for every set, which takes precedence over the default
+func Render(ctx context.Context, templateSet string, locale string, name string, variables map[string]string) (*Rendered, error) {
+	list, err := loadOverrides(ctx, name)
+	if err != nil {
+		// The defaults are still better than no email at all
+		log.Printf("failed to load the overrides of email template %s: %s", name, err)
+	}
+
+	custom := map[string]*models.EmailTemplate{}
+	for _, t := range list {
+		custom[t.TemplateSet+"/"+t.Locale] = t
+	}
+
+	for _, l := range fallbackLocales(locale) {
+		t, ok := custom[templateSet+"/"+l]
+		if !ok {
+			t, ok = custom["/"+l]
+		}
+
+		if ok {
+			parsed, err := parseOverride(t)
+			if err != nil {
+				return nil, err
+			}
+
+			return execute(parsed, locale, name, variables)
+		}
+
+		parsed, err := parseDefault(l, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return execute(parsed, locale, name, variables)
+	}
+
+	return nil, ErrTemplateNotFound
+}
+
+// RenderTemplate executes a template that is not stored yet, to validate
+// or preview it. An empty subject uses the catalog of the template locale
+func RenderTemplate(t *models.EmailTemplate, variables map[string]string) (*Rendered, error) {
+	parsed, err := parse(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return execute(parsed, t.Locale, t.Name, variables)
+}
+
+// DefaultTemplate returns the source of the default template in the
+// closest locale having it, with the subject of the catalog
+func DefaultTemplate(locale string, name string) (*models.EmailTemplate, error) {
+	for _, l := range fallbackLocales(locale) {
+		html, err := fs.ReadFile(Defaults, path.Join(l, name+".html"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		text, err := fs.ReadFile(Defaults, path.Join(l, name+".txt"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		return &models.EmailTemplate{
+			Name:    name,
+			Locale:  l,
+			Subject: Translate(locale, name+".subject"),
+			HTML:    string(html),
+			Text:    string(text),
+		}, nil
+	}
+
+	return nil, ErrTemplateNotFound
+}
+
+// TemplateNames returns the names of the default templates
+func TemplateNames() []string {
+	seen := map[string]bool{}
+
+	for _, locale := range Locales() {
+		matches, _ := fs.Glob(Defaults, path.Join(locale, "*.html"))
+		for _, m := range matches {
+			seen[strings.TrimSuffix(path.Base(m), ".html")] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SampleVariables returns the variables used to preview a template
+func SampleVariables(name string) map[string]string {
+	return map[string]string{
+		"name":         "Ana García",
+		"email":        "ana.garcia@example.com",
+		"link":         "https://example.com/" + name + "?token=sample",
+		"app_name":     "Mi Tour",
+		"logo_url":     "https://example.com/logo.png",
+		"frontend_url": "https://example.com",
+		"expires_at":   "2030-01-01 00:00 UTC",
+		"organization": "Acme",
+	}
+}
+
+// Translate returns the message of the catalog of the closest locale
+// defining it, or the key itself when none does
+func Translate(locale string, key string) string {
+	for _, l := range fallbackLocales(locale) {
+		if message, ok := catalog(l)[key]; ok {
+			return message
+		}
+	}
+
+	return key
+}
+
+// catalog returns the cached message catalog of a locale
+func catalog(locale string) map[string]string {
+	store.RLock()
+	messages, ok := store.catalogs[locale]
+	store.RUnlock()
+
+	if ok {
+		return messages
+	}
+
+	messages = map[string]string{}
+
+	data, err := fs.ReadFile(Defaults, path.Join(locale, catalogFile))
+	if err == nil {
+		if err = json.Unmarshal(data, &messages); err != nil {
+			log.Printf("invalid message catalog %s: %s", locale, err)
+		}
+	}
+
+	store.Lock()
+	store.catalogs[locale] = messages
+	store.Unlock()
+
+	return messages
+}
+
+// parseDefault returns the cached default template of a locale
+func parseDefault(locale string, name string) (*parsedTemplate, error) {
+	key := locale + "/" + name
+
+	store.RLock()
+	parsed, ok := store.defaults[key]
+	store.RUnlock()
+
+	if ok {
+		return parsed, nil
+	}
+
+	html, err := fs.ReadFile(Defaults, path.Join(locale, name+".html"))
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := fs.ReadFile(Defaults, path.Join(locale, name+".txt"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	parsed, err = parse(&models.EmailTemplate{
+		Name:   name,
+		Locale: locale,
+		HTML:   string(html),
+		Text:   string(text),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store.Lock()
+	store.defaults[key] = parsed
+	store.Unlock()
+
+	return parsed, nil
+}
+
+// parseOverride returns the cached override, parsed again when updated
+func parseOverride(t *models.EmailTemplate) (*parsedTemplate, error) {
+	key := t.TemplateSet + "/" + t.Locale + "/" + t.Name
+
+	store.RLock()
+	parsed, ok := store.custom[key]
+	store.RUnlock()
+
+	if ok && parsed.updatedAt.Equal(t.UpdatedAt) {
+		return parsed, nil
+	}
+
+	parsed, err := parse(t)
+	if err != nil {
+		return nil, err
+	}
+
+	store.Lock()
+	store.custom[key] = parsed
+	store.Unlock()
+
+	return parsed, nil
+}
+
+// parse parses the subject, HTML and text of a template. Missing
+// variables render as empty strings
+func parse(t *models.EmailTemplate) (*parsedTemplate, error) {
+	if strings.TrimSpace(t.HTML) == "" {
+		return nil, errors.New("html is required")
+	}
+
+	parsed := &parsedTemplate{updatedAt: t.UpdatedAt}
+
+	var err error
+
+	parsed.html, err = htmltemplate.New(t.Name + ".html").Option("missingkey=zero").Parse(t.HTML)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(t.Subject) != "" {
+		parsed.subject, err = template.New(t.Name + ".subject").Option("missingkey=zero").Parse(t.Subject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(t.Text) != "" {
+		parsed.text, err = template.New(t.Name + ".txt").Option("missingkey=zero").Parse(t.Text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parsed, nil
+}
+
+// execute renders a parsed template
+func execute(parsed *parsedTemplate, locale string, name string, variables map[string]string) (*Rendered, error) {
+	rendered := &Rendered{}
+
+	html := &bytes.Buffer{}
+	if err := parsed.html.Execute(html, variables); err != nil {
+		return nil, err
+	}
+	rendered.HTML = html.String()
+
+	if parsed.text != nil {
+		text := &bytes.Buffer{}
+		if err := parsed.text.Execute(text, variables); err != nil {
+			return nil, err
+		}
+		rendered.Text = text.String()
+	}
+
+	// The subjects of the catalog are templates as well
+	subjectTmpl := parsed.subject
+	if subjectTmpl == nil {
+		var err error
+		subjectTmpl, err = template.New(name + ".subject").Option("missingkey=zero").Parse(Translate(locale, name+".subject"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	subject := &bytes.Buffer{}
+	if err := subjectTmpl.Execute(subject, variables); err != nil {
+		return nil, err
+	}
+	rendered.Subject = subject.String()
+
+	// A subject is a single header line
+	rendered.Subject = strings.Join(strings.Fields(rendered.Subject), " ")
+
+	if rendered.Subject == "" {
+		return nil, fmt.Errorf("email template %s has no subject", name)
+	}
+
+	return rendered, nil
+}
@@ -7,23 +7,50 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
 	"github.com/tapiaw38/auth-api/internal/server"
 )
 
 var (
+	// NO_AUTH_NEEDED are the routes, as registered, reachable without a token
 	NO_AUTH_NEEDED = []string{
-		"login",
-		"signup",
-		"verify-email",
-		"reset-password",
-		"change-password",
+		"/auth/login",
+		"/auth/signup",
+		"/auth/verify-email",
+		"/auth/reset-password",
+		"/auth/change-password",
 	}
 )
 
-// shouldCheckToken is a function that checks if the route should be checked for token
+// ClaimsKey is the context key under which the token claims are stored
+const ClaimsKey = "claims"
+
+// Cookies and header used by the cookie based session mode
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFTokenHeader    = "X-CSRF-Token"
+)
+
+// GetTokenString returns the access token of the request, taken from the
+// Authorization header or else from the access token cookie
+func GetTokenString(c *gin.Context) string {
+	tokenString := strings.TrimSpace(c.GetHeader("Authorization"))
+	if tokenString != "" {
+		return tokenString
+	}
+
+	tokenString, _ = c.Cookie(AccessTokenCookie)
+
+	return tokenString
+}
+
+// shouldCheckToken is a function that checks if the route should be checked for token.
+// The route is matched exactly, a path merely containing a public one is checked
 func shouldCheckToken(route string) bool {
 	for _, p := range NO_AUTH_NEEDED {
-		if strings.Contains(route, p) {
+		if route == p {
 			return false
 		}
 	}
@@ -33,13 +60,13 @@ func shouldCheckToken(route string) bool {
 // CheckAuthMiddleware is a middleware that checks if the user is authenticated
 func CheckAuthMiddleware(s server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !shouldCheckToken(c.Request.URL.Path) {
+		if !shouldCheckToken(c.FullPath()) {
 			c.Next()
 			return
 		}
 
-		tokenString := strings.TrimSpace(c.GetHeader("Authorization"))
-		_, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
+		tokenString := GetTokenString(c)
+		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
 			return []byte(s.Config().JWTSecret), nil
 		})
 
@@ -48,6 +75,28 @@ func CheckAuthMiddleware(s server.Server) gin.HandlerFunc {
 			return
 		}
 
+		claims, ok := token.Claims.(*models.AppClaims)
+		if !ok || !token.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		// Tokens issued before the last revocation are no longer valid
+		version, err := repository.GetUserTokenVersion(c.Request.Context(), claims.UserId)
+		if err != nil || version != claims.TokenVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+
+		// The session may have been revoked from another device
+		active, err := repository.TouchSession(c.Request.Context(), claims.SessionId, claims.UserId)
+		if err != nil || !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+
 		c.Next()
 	}
 }
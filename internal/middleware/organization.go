@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+)
+
+// Context keys under which RequireOrganization stores the organization
+// selected by the token and the membership of the caller
+const (
+	OrganizationKey = "organization"
+	MembershipKey   = "membership"
+)
+
+// RequireOrganization is a middleware that scopes the request to the
+// organization selected by the token. It only lets through active members
+// of an active organization holding one of the given roles within it, any
+// member when no role is given
+func RequireOrganization(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(ClaimsKey)
+
+		claims, ok := value.(*models.AppClaims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		if claims.OrgId == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no organization selected"})
+			return
+		}
+
+		organization, err := repository.GetOrganizationById(c.Request.Context(), claims.OrgId)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		membership, err := repository.GetMembership(c.Request.Context(), claims.OrgId, claims.UserId)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if organization == nil || !organization.IsActive || membership == nil || membership.Status != models.MembershipActive {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		if len(roles) > 0 && !membership.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+
+		c.Set(OrganizationKey, organization)
+		c.Set(MembershipKey, membership)
+
+		c.Next()
+	}
+}
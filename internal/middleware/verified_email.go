@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/config"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/server"
+)
+
+// RequireVerifiedEmail is a middleware that rejects users without a verified
+// email when the email verification policy restricts them
+func RequireVerifiedEmail(s server.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.Config().EmailVerificationPolicy == config.EmailVerificationNone {
+			c.Next()
+			return
+		}
+
+		value, _ := c.Get(ClaimsKey)
+
+		claims, ok := value.(*models.AppClaims)
+		if !ok || !claims.Verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Application is a frontend served by the auth api. It brands the emails
+// sent to the users who signed up through it
+type Application struct {
+	Id            string    `json:"id"`
+	Name          string    `json:"name"`
+	FrontendURL   string    `json:"frontend_url"`
+	SenderName    string    `json:"sender_name"`
+	SenderAddress string    `json:"sender_address"`
+	LogoURL       string    `json:"logo_url"`
+	TemplateSet   string    `json:"template_set"`
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
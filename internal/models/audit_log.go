@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// Audit log actions
+const (
+	AuditActionSignUp               = "auth.signup"
+	AuditActionLogin                = "auth.login"
+	AuditActionLogout               = "auth.logout"
+	AuditActionRefreshToken         = "auth.refresh_token"
+	AuditActionVerifyEmail          = "auth.verify_email"
+	AuditActionResendVerification   = "auth.resend_verification"
+	AuditActionPasswordResetRequest = "auth.password_reset_request"
+	AuditActionPasswordReset        = "auth.password_reset"
+	AuditActionPasswordChange       = "user.password_change"
+	AuditActionUserUpdate           = "user.update"
+	AuditActionEmailChangeRequest   = "user.email_change_request"
+	AuditActionEmailChangeConfirm   = "user.email_change_confirm"
+	AuditActionEmailChangeCancel    = "user.email_change_cancel"
+	AuditActionEmailChangeRevert    = "user.email_change_revert"
+	AuditActionSessionRevoke        = "session.revoke"
+	AuditActionRoleCreate           = "role.create"
+	AuditActionRoleUpdate           = "role.update"
+	AuditActionRoleDelete           = "role.delete"
+	AuditActionRoleGrant            = "user_role.grant"
+	AuditActionRoleRevoke           = "user_role.revoke"
+	AuditActionWebhookCreate        = "webhook.create"
+	AuditActionWebhookUpdate        = "webhook.update"
+	AuditActionWebhookDelete        = "webhook.delete"
+	AuditActionWebhookRedeliver     = "webhook.redeliver"
+	AuditActionEmailRequeue         = "email.requeue"
+	AuditActionEmailTemplateUpdate  = "email_template.update"
+	AuditActionEmailTemplateDelete  = "email_template.delete"
+	AuditActionApplicationCreate    = "application.create"
+	AuditActionApplicationUpdate    = "application.update"
+	AuditActionApplicationDelete    = "application.delete"
+	AuditActionOrganizationCreate   = "organization.create"
+	AuditActionOrganizationUpdate   = "organization.update"
+	AuditActionOrganizationSwitch   = "organization.switch"
+	AuditActionMembershipInvite     = "membership.invite"
+	AuditActionMembershipAccept     = "membership.accept"
+	AuditActionMembershipRemove     = "membership.remove"
+	AuditActionInvitationCreate     = "invitation.create"
+	AuditActionInvitationRevoke     = "invitation.revoke"
+	AuditActionInvitationAccept     = "invitation.accept"
+	AuditActionUserActivate         = "user.activate"
+	AuditActionUserDeactivate       = "user.deactivate"
+	AuditActionUserDelete           = "user.delete"
+	AuditActionPasswordResetForce   = "user.password_reset_force"
+)
+
+// Audit log outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditLog is the model for the append only audit_logs table
+type AuditLog struct {
+	Id        string                 `json:"id"`
+	ActorId   string                 `json:"actor_id,omitempty"`
+	TargetId  string                 `json:"target_id,omitempty"`
+	Action    string                 `json:"action"`
+	Outcome   string                 `json:"outcome"`
+	Ip        string                 `json:"ip,omitempty"`
+	UserAgent string                 `json:"user_agent,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditLogFilter holds the criteria to list audit logs. UserId matches
+// either the actor or the target. The cursor is the position of the last
+// row of the previous page
+type AuditLogFilter struct {
+	UserId          string
+	Action          string
+	From            time.Time
+	To              time.Time
+	CursorCreatedAt time.Time
+	CursorId        string
+	Limit           int
+}
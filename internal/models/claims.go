@@ -4,7 +4,11 @@ import "github.com/golang-jwt/jwt"
 
 // AppClaims is the model for the claims
 type AppClaims struct {
-	UserId string `json:"userId"`
-	Email  string `json:"email"`
+	UserId       string `json:"userId"`
+	Email        string `json:"email"`
+	TokenVersion int    `json:"tokenVersion"`
+	SessionId    string `json:"sessionId"`
+	Verified     bool   `json:"verified"`
+	OrgId        string `json:"org_id,omitempty"`
 	jwt.StandardClaims
 }
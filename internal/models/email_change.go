@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// EmailChange is the model for the email_changes table. Once confirmed it
+// is kept until it expires so that the old address can revert it
+type EmailChange struct {
+	Id          string    `json:"id"`
+	UserId      string    `json:"user_id"`
+	OldEmail    string    `json:"old_email"`
+	NewEmail    string    `json:"new_email"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ConfirmedAt time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Revertible reports whether the change has been applied and can still be
+// reverted from the old address
+func (ec *EmailChange) Revertible() bool {
+	return !ec.ConfirmedAt.IsZero() && time.Now().Before(ec.ExpiresAt)
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type EmailMessage struct {
 	To        string            `json:"to"`
 	From      string            `json:"from"`
@@ -8,3 +10,21 @@ type EmailMessage struct {
 	Body      string            `json:"body"`
 	Variables map[string]string `json:"variables"`
 }
+
+// DeadLetterEmail describes an email message that could not be sent
+type DeadLetterEmail struct {
+	MessageId   string    `json:"message_id"`
+	To          string    `json:"to"`
+	From        string    `json:"from"`
+	Subject     string    `json:"subject"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// OutboxEmail is an email stored while RabbitMQ was unreachable
+type OutboxEmail struct {
+	Id        string
+	Message   EmailMessage
+	CreatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmailTemplate overrides the embedded default of an email template in a
+// locale, for the applications using its template set or for all of them
+// when the set is empty. An empty subject keeps the subject of the message
+// catalog, an empty text sends the HTML part only
+type EmailTemplate struct {
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Locale      string    `json:"locale"`
+	TemplateSet string    `json:"template_set"`
+	Subject     string    `json:"subject"`
+	HTML        string    `json:"html"`
+	Text        string    `json:"text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types, also used as routing keys
+const (
+	EventUserCreated  = "user.created"
+	EventUserVerified = "user.verified"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventRoleGranted  = "role.granted"
+	EventRoleRevoked  = "role.revoked"
+)
+
+// EventTypes lists every domain event type
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserVerified,
+	EventUserUpdated,
+	EventUserDeleted,
+	EventRoleGranted,
+	EventRoleRevoked,
+}
+
+// EventVersion is the version of the event envelope and payloads, it is
+// bumped on breaking changes so consumers can tell them apart
+const EventVersion = 1
+
+// Event is the envelope of a domain event published to other services
+type Event struct {
+	Id         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// UserEventPayload is the payload of the user events
+type UserEventPayload struct {
+	Id            string   `json:"id"`
+	Email         string   `json:"email"`
+	Username      string   `json:"username"`
+	FirstName     string   `json:"first_name"`
+	LastName      string   `json:"last_name"`
+	IsActive      bool     `json:"is_active"`
+	VerifiedEmail bool     `json:"verified_email"`
+	Roles         []string `json:"roles"`
+}
+
+// RoleEventPayload is the payload of the role events
+type RoleEventPayload struct {
+	UserId         string `json:"user_id"`
+	RoleId         string `json:"role_id"`
+	OrganizationId string `json:"organization_id,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Invitation is the model for the invitations table, an account offered
+// by an admin to an email address with pre-assigned roles. Only the hash
+// of the token sent to the invitee is stored
+type Invitation struct {
+	Id            string    `json:"id"`
+	Email         string    `json:"email"`
+	FirstName     string    `json:"first_name,omitempty"`
+	LastName      string    `json:"last_name,omitempty"`
+	RoleIds       []string  `json:"role_ids"`
+	ApplicationId string    `json:"application_id,omitempty"`
+	Locale        string    `json:"locale"`
+	InvitedBy     string    `json:"invited_by,omitempty"`
+	TokenHash     string    `json:"-"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	AcceptedAt    time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy    string    `json:"accepted_by,omitempty"`
+	RevokedAt     time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
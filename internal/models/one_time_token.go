@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// One time token purposes
+const (
+	TokenPurposeVerifyEmail        = "verify_email"
+	TokenPurposeResetPassword      = "reset_password"
+	TokenPurposeEmailChangeConfirm = "email_change_confirm"
+	TokenPurposeEmailChangeCancel  = "email_change_cancel"
+)
+
+// OneTimeToken is the model for the one_time_tokens table, only the hash of
+// the token sent to the user is stored
+type OneTimeToken struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
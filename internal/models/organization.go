@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Membership statuses, an invited user becomes a member on acceptance
+const (
+	MembershipInvited = "invited"
+	MembershipActive  = "active"
+)
+
+// Organization is a tenant grouping users, with its own roles
+type Organization struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership is the model for the memberships table, a user belonging to
+// an organization with the roles granted within it
+type Membership struct {
+	OrganizationId string        `json:"organization_id"`
+	UserId         string        `json:"user_id"`
+	Status         string        `json:"status"`
+	InvitedBy      string        `json:"invited_by,omitempty"`
+	Roles          []Role        `json:"roles,omitempty"`
+	Organization   *Organization `json:"organization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// HasRole reports whether the membership has any of the given roles
+func (m *Membership) HasRole(names ...string) bool {
+	for _, role := range m.Roles {
+		for _, name := range names {
+			if role.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is the model for the sessions table, one row per login
+type Session struct {
+	Id                    string    `json:"id"`
+	UserId                string    `json:"user_id"`
+	UserAgent             string    `json:"user_agent,omitempty"`
+	Ip                    string    `json:"ip,omitempty"`
+	TokenFamily           string    `json:"token_family"`
+	OrganizationId        string    `json:"organization_id,omitempty"`
+	RefreshTokenHash      string    `json:"-"`
+	RefreshTokenExpiresAt time.Time `json:"-"`
+	CreatedAt             time.Time `json:"created_at"`
+	LastSeenAt            time.Time `json:"last_seen_at"`
+	RevokedAt             time.Time `json:"revoked_at,omitempty"`
+}
@@ -6,24 +6,23 @@ import (
 
 // User is the model for the user table
 type User struct {
-	Id                       string    `json:"id"`
-	FirstName                string    `json:"first_name,omitempty"`
-	LastName                 string    `json:"last_name,omitempty"`
-	Username                 string    `json:"username"`
-	Email                    string    `json:"email"`
-	Password                 string    `json:"password"`
-	PhoneNumber              string    `json:"phone_number,omitempty"`
-	Picture                  string    `json:"picture,omitempty"`
-	Address                  string    `json:"address,omitempty"`
-	IsActive                 bool      `json:"is_active,omitempty"`
-	VerifiedEmail            bool      `json:"verified_email,omitempty"`
-	VerifiedEmailToken       string    `json:"token,omitempty"`
-	VerifiedEmailTokenExpiry time.Time `json:"token_expiry,omitempty"`
-	PasswordResetToken       string    `json:"password_reset_token,omitempty"`
-	PasswordResetTokenExpiry time.Time `json:"password_reset_token_expiry,omitempty"`
-	Roles                    []Role    `json:"roles,omitempty"`
-	CreatedAt                time.Time `json:"created_at,omitempty"`
-	UpdatedAt                time.Time `json:"updated_at,omitempty"`
+	Id            string    `json:"id"`
+	FirstName     string    `json:"first_name,omitempty"`
+	LastName      string    `json:"last_name,omitempty"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Password      string    `json:"password"`
+	PhoneNumber   string    `json:"phone_number,omitempty"`
+	Picture       string    `json:"picture,omitempty"`
+	Address       string    `json:"address,omitempty"`
+	IsActive      bool      `json:"is_active,omitempty"`
+	VerifiedEmail bool      `json:"verified_email,omitempty"`
+	TokenVersion  int       `json:"token_version,omitempty"`
+	Locale        string    `json:"locale,omitempty"`
+	ApplicationId string    `json:"application_id,omitempty"`
+	Roles         []Role    `json:"roles,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
 }
 
 // UserResponse is the model for the user table without the password
@@ -38,7 +37,44 @@ type UserResponse struct {
 	Address       string    `json:"address,omitempty"`
 	IsActive      bool      `json:"is_active,omitempty"`
 	VerifiedEmail bool      `json:"verified_email,omitempty"`
+	Locale        string    `json:"locale,omitempty"`
+	ApplicationId string    `json:"application_id,omitempty"`
 	Roles         []Role    `json:"roles,omitempty"`
 	CreatedAt     time.Time `json:"created_at,omitempty"`
 	UpdatedAt     time.Time `json:"updated_at,omitempty"`
 }
+
+// HasRole reports whether the user has any of the given roles
+func (u *User) HasRole(names ...string) bool {
+	for _, role := range u.Roles {
+		for _, name := range names {
+			if role.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// UserSort is a column to sort users by
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// UserFilter holds the criteria to list users. Search matches the name,
+// email or username. Role matches the name of a global role. A nil boolean
+// does not filter. The cursor is the position of the last row of the
+// previous page, its values of the sort fields followed by its id
+type UserFilter struct {
+	Search        string
+	Role          string
+	IsActive      *bool
+	VerifiedEmail *bool
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	Sort          []UserSort
+	Cursor        []string
+	Limit         int
+}
@@ -1,7 +1,9 @@
 package models
 
-// UserRole is the model for the user_role table
+// UserRole is the model for the user_role table, a role without an
+// organization is global
 type UserRole struct {
-	UserId string `json:"user_id"`
-	RoleId string `json:"role_id"`
+	UserId         string `json:"user_id"`
+	RoleId         string `json:"role_id"`
+	OrganizationId string `json:"organization_id,omitempty"`
 }
@@ -0,0 +1,440 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/streadway/amqp"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+// Email queues. They are durable, so they are named apart from the former
+// non-durable email_queue, which a broker would refuse to redeclare
+const (
+	EmailQueue           = "emails"
+	EmailDeadLetterQueue = "emails.dead"
+)
+
+// Headers carried by the email messages
+const (
+	attemptsHeader  = "x-attempts"
+	lastErrorHeader = "x-last-error"
+)
+
+// EmailRetryDelays are the delays before each new attempt to send an email,
+// a message failing once more is moved to the dead letter queue
+var EmailRetryDelays = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+}
+
+const (
+	// emailPrefetch is the number of unacknowledged messages a consumer holds
+	emailPrefetch = 10
+	// emailConsumer is the consumer tag of the email consumer
+	emailConsumer = "email-sender"
+)
+
+// emailRetryQueue returns the name of the delay queue of an attempt
+func emailRetryQueue(delay time.Duration) string {
+	return EmailQueue + ".retry." + strconv.Itoa(int(delay.Seconds()))
+}
+
+// declareEmailQueues declares the email queue, its delay queues and its
+// dead letter queue. A delay queue holds messages for its TTL, then
+// dead-letters them back to the email queue
+func declareEmailQueues(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		EmailQueue, // queue name
+		true,       // durable
+		false,      // delete when unused
+		false,      // exclusive
+		false,      // no-wait
+		nil,        // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, delay := range EmailRetryDelays {
+		_, err = ch.QueueDeclare(
+			emailRetryQueue(delay), // queue name
+			true,                   // durable
+			false,                  // delete when unused
+			false,                  // exclusive
+			false,                  // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": EmailQueue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = ch.QueueDeclare(
+		EmailDeadLetterQueue, // queue name
+		true,                 // durable
+		false,                // delete when unused
+		false,                // exclusive
+		false,                // no-wait
+		nil,                  // arguments
+	)
+
+	return err
+}
+
+// EmailTemplate describes an email to render from a template
+type EmailTemplate struct {
+	From            mail.Address
+	To              string
+	TemplateSet     string
+	Locale          string
+	Name            string
+	Variables       map[string]string
+	ListUnsubscribe []string
+	Inline          []mailer.InlineImage
+}
+
+// NewEmailMessage renders an email template into a MIME message
+func NewEmailMessage(ctx context.Context, t *EmailTemplate) (*models.EmailMessage, error) {
+	rendered, err := mailer.Render(ctx, t.TemplateSet, t.Locale, t.Name, t.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	composed, err := mailer.Compose(&mailer.Message{
+		From:            t.From,
+		To:              mail.Address{Address: t.To},
+		Subject:         rendered.Subject,
+		Text:            rendered.Text,
+		HTML:            rendered.HTML,
+		ListUnsubscribe: t.ListUnsubscribe,
+		Inline:          t.Inline,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(composed.Headers))
+	for _, h := range composed.Headers {
+		headers[h.Key] = h.Value
+	}
+
+	return &models.EmailMessage{
+		To:        t.To,
+		From:      t.From.Address,
+		Subject:   rendered.Subject,
+		Headers:   headers,
+		Body:      string(composed.Raw),
+		Variables: t.Variables,
+	}, nil
+}
+
+// PublishEmailMessage renders an email template and publishes it to RabbitMQ
+func (c *RabbitMQConnection) PublishEmailMessage(ctx context.Context, t *EmailTemplate) error {
+	msg, err := NewEmailMessage(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	return c.PublishEmail(msg)
+}
+
+// PublishEmail publishes an email message to the email queue
+func (c *RabbitMQConnection) PublishEmail(msg *models.EmailMessage) error {
+	jsonMsg, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	return c.Publish(
+		"",         // exchange
+		EmailQueue, // routing key
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    id.String(),
+			Timestamp:    time.Now(),
+			Body:         jsonMsg,
+		})
+}
+
+// ConsumeEmailMessage consumes the email messages from RabbitMQ until the
+// connection is closed. A message is acknowledged once sent, retried
+// through the delay queues when sending fails, and dead-lettered when it
+// cannot be decoded or runs out of retries
+func (c *RabbitMQConnection) ConsumeEmailMessage(sender mailer.EmailSender) error {
+	c.consumers.Add(1)
+	defer c.consumers.Done()
+
+	for {
+		ch, err := c.Channel()
+		if errors.Is(err, ErrClosed) {
+			return nil
+		}
+
+		if err == nil {
+			err = ch.Qos(emailPrefetch, 0, false)
+			if err != nil {
+				ch.Close()
+			}
+		}
+
+		var msgs <-chan amqp.Delivery
+		if err == nil {
+			msgs, err = ch.Consume(
+				EmailQueue,    // queue
+				emailConsumer, // consumer
+				false,         // auto-ack
+				false,         // exclusive
+				false,         // no-local
+				false,         // no-wait
+				nil,           // args
+			)
+			if err != nil {
+				ch.Close()
+			}
+		}
+
+		if err != nil {
+			if !errors.Is(err, ErrNotConnected) {
+				log.Printf("Failed to consume messages: %s", err)
+			}
+
+			select {
+			case <-c.done:
+				return nil
+			case <-time.After(time.Second):
+			}
+
+			continue
+		}
+
+		if c.consume(ch, msgs, sender) {
+			return nil
+		}
+	}
+}
+
+// consume handles the deliveries until the channel closes, or the
+// connection is being closed, in which case it returns true
+func (c *RabbitMQConnection) consume(ch *amqp.Channel, msgs <-chan amqp.Delivery, sender mailer.EmailSender) bool {
+	defer ch.Close()
+
+	for {
+		select {
+		case <-c.done:
+			// Unacknowledged prefetched messages are requeued with the channel
+			ch.Cancel(emailConsumer, false)
+			return true
+		case msg, ok := <-msgs:
+			if !ok {
+				return false
+			}
+
+			c.handleEmailMessage(msg, sender)
+		}
+	}
+}
+
+// handleEmailMessage sends one email message and settles it
+func (c *RabbitMQConnection) handleEmailMessage(msg amqp.Delivery, sender mailer.EmailSender) {
+	var email models.EmailMessage
+
+	err := json.Unmarshal(msg.Body, &email)
+	if err == nil && email.To == "" {
+		err = errors.New("missing recipient")
+	}
+
+	if err != nil {
+		// A poison message would fail forever, it is not retried
+		log.Printf("failed to decode email message %s: %s", msg.MessageId, err)
+		c.settleEmailMessage(msg, EmailDeadLetterQueue, emailAttempts(msg), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailer.SendTimeout)
+	err = sender.SendEmail(ctx, &email)
+	cancel()
+	if err == nil {
+		msg.Ack(false)
+		return
+	}
+
+	attempts := emailAttempts(msg) + 1
+	log.Printf("Failed to send email %s (attempt %d): %s", msg.MessageId, attempts, err)
+
+	if attempts > len(EmailRetryDelays) {
+		c.settleEmailMessage(msg, EmailDeadLetterQueue, attempts, err)
+		return
+	}
+
+	c.settleEmailMessage(msg, emailRetryQueue(EmailRetryDelays[attempts-1]), attempts, err)
+}
+
+// settleEmailMessage moves a message to another queue, then acknowledges
+// it. If the message cannot be moved it is requeued instead
+func (c *RabbitMQConnection) settleEmailMessage(msg amqp.Delivery, queue string, attempts int, cause error) {
+	err := c.Publish(
+		"",    // exchange
+		queue, // routing key
+		amqp.Publishing{
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageId,
+			Timestamp:    msg.Timestamp,
+			Headers: amqp.Table{
+				attemptsHeader:  int32(attempts),
+				lastErrorHeader: cause.Error(),
+			},
+			Body: msg.Body,
+		})
+	if err != nil {
+		log.Printf("failed to move email message %s to %s: %s", msg.MessageId, queue, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	msg.Ack(false)
+}
+
+// emailAttempts returns the number of failed attempts of a message
+func emailAttempts(msg amqp.Delivery) int {
+	switch attempts := msg.Headers[attemptsHeader].(type) {
+	case int32:
+		return int(attempts)
+	case int64:
+		return int(attempts)
+	default:
+		return 0
+	}
+}
+
+// ListDeadLetterEmail returns up to limit messages of the dead letter queue
+// without removing them. Bodies are left out, they hold one time links
+func (c *RabbitMQConnection) ListDeadLetterEmail(limit int) ([]*models.DeadLetterEmail, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// Closing the channel requeues every message that was read
+	defer ch.Close()
+
+	deadLetters := []*models.DeadLetterEmail{}
+
+	for len(deadLetters) < limit {
+		msg, ok, err := ch.Get(EmailDeadLetterQueue, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		deadLetters = append(deadLetters, newDeadLetterEmail(msg))
+	}
+
+	return deadLetters, nil
+}
+
+// RequeueDeadLetterEmail moves the dead letters with the given message ids
+// back to the email queue with a fresh retry budget, every dead letter when
+// no id is given. It returns the number of requeued messages
+func (c *RabbitMQConnection) RequeueDeadLetterEmail(messageIds []string) (int, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return 0, err
+	}
+	// Closing the channel requeues the messages that were not moved
+	defer ch.Close()
+
+	wanted := map[string]bool{}
+	for _, id := range messageIds {
+		wanted[id] = true
+	}
+
+	// Only the messages present now are visited
+	queue, err := ch.QueueInspect(EmailDeadLetterQueue)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+
+	for i := 0; i < queue.Messages; i++ {
+		msg, ok, err := ch.Get(EmailDeadLetterQueue, false)
+		if err != nil {
+			return requeued, err
+		}
+
+		if !ok {
+			break
+		}
+
+		if len(wanted) > 0 && !wanted[msg.MessageId] {
+			continue
+		}
+
+		err = c.Publish(
+			"",         // exchange
+			EmailQueue, // routing key
+			amqp.Publishing{
+				ContentType:  msg.ContentType,
+				DeliveryMode: amqp.Persistent,
+				MessageId:    msg.MessageId,
+				Timestamp:    msg.Timestamp,
+				Body:         msg.Body,
+			})
+		if err != nil {
+			return requeued, err
+		}
+
+		err = msg.Ack(false)
+		if err != nil {
+			return requeued, err
+		}
+
+		requeued++
+	}
+
+	return requeued, nil
+}
+
+// newDeadLetterEmail describes a dead letter message
+func newDeadLetterEmail(msg amqp.Delivery) *models.DeadLetterEmail {
+	deadLetter := models.DeadLetterEmail{
+		MessageId:   msg.MessageId,
+		Attempts:    emailAttempts(msg),
+		PublishedAt: msg.Timestamp,
+	}
+
+	if lastError, ok := msg.Headers[lastErrorHeader].(string); ok {
+		deadLetter.LastError = lastError
+	}
+
+	var email models.EmailMessage
+	if err := json.Unmarshal(msg.Body, &email); err == nil {
+		deadLetter.To = email.To
+		deadLetter.From = email.From
+		deadLetter.Subject = email.Subject
+	}
+
+	return &deadLetter
+}
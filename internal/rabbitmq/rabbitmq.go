@@ -1,243 +1,372 @@
 package rabbitmq
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
-	"html/template"
+	"errors"
 	"log"
-	"net/mail"
+	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
 	"github.com/tapiaw38/auth-api/internal/models"
 )
 
-// RabbitMQConnection is the connection to RabbitMQ
+var (
+	// ErrNotConnected is returned while the connection is being reestablished
+	ErrNotConnected = errors.New("rabbitmq: not connected")
+	// ErrClosed is returned once the connection has been closed
+	ErrClosed = errors.New("rabbitmq: connection closed")
+	// ErrNacked is returned when the broker refuses a published message
+	ErrNacked = errors.New("rabbitmq: message not confirmed by the broker")
+)
+
+const (
+	// reconnectMinDelay and reconnectMaxDelay bound the backoff between two
+	// connection attempts
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+	// ConfirmTimeout bounds the wait for a publisher confirm
+	ConfirmTimeout = 5 * time.Second
+	// shutdownTimeout bounds the wait for the consumers on Close
+	shutdownTimeout = 15 * time.Second
+	// DefaultChannelPoolSize is the number of idle publisher channels kept open
+	DefaultChannelPoolSize = 8
+)
+
+// RabbitMQConnection is a long lived connection to RabbitMQ. It reconnects
+// with backoff whenever the connection drops and keeps a pool of channels
+// in confirm mode for the publishers
 type RabbitMQConnection struct {
-	Conn *amqp.Connection
+	url            string
+	eventsExchange string
+
+	mu   sync.RWMutex
+	conn *amqp.Connection
+
+	pool      chan *publisherChannel
+	done      chan struct{}
+	closeOnce sync.Once
+	consumers sync.WaitGroup
+}
+
+// publisherChannel is a channel in confirm mode with its confirmations
+type publisherChannel struct {
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
 }
 
 // RabbitMQConfig is the RabbitMQ configuration
 type RabbitMQConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	EventsExchange  string
+	ChannelPoolSize int
+
+	once       sync.Once
+	connection *RabbitMQConnection
 }
 
 // NewRabbitMQConfig creates a new RabbitMQ configuration
 func NewRabbitMQConfig(conf *RabbitMQConfig) *RabbitMQConfig {
 	return &RabbitMQConfig{
-		Host:     conf.Host,
-		Port:     conf.Port,
-		User:     conf.User,
-		Password: conf.Password,
+		Host:            conf.Host,
+		Port:            conf.Port,
+		User:            conf.User,
+		Password:        conf.Password,
+		EventsExchange:  conf.EventsExchange,
+		ChannelPoolSize: conf.ChannelPoolSize,
 	}
 }
 
-// Connection creates a new RabbitMQ connection
+// Connection returns the shared RabbitMQ connection, dialing it in the
+// background on the first call. It never blocks nor fails, calls made
+// while the broker is unreachable return ErrNotConnected
 func (c *RabbitMQConfig) Connection() *RabbitMQConnection {
-	conn, err := amqp.Dial("amqp://" + c.User + ":" + c.Password + "@" + c.Host + ":" + c.Port + "/")
-	if err != nil {
-		log.Fatalf("failed to connect to RabbitMQ: %s", err)
-	}
+	c.once.Do(func() {
+		size := c.ChannelPoolSize
+		if size <= 0 {
+			size = DefaultChannelPoolSize
+		}
 
-	return &RabbitMQConnection{
-		Conn: conn,
-	}
-}
+		c.connection = &RabbitMQConnection{
+			url:            "amqp://" + c.User + ":" + c.Password + "@" + c.Host + ":" + c.Port + "/",
+			eventsExchange: c.EventsExchange,
+			pool:           make(chan *publisherChannel, size),
+			done:           make(chan struct{}),
+		}
 
-// Channel creates a new RabbitMQ channel
-func (c *RabbitMQConnection) Channel() (*amqp.Channel, error) {
-	return c.Conn.Channel()
+		go c.connection.run()
+	})
+
+	return c.connection
 }
 
-// Close closes the RabbitMQ connection
-func (c *RabbitMQConnection) Close() {
-	c.Conn.Close()
+// run keeps the connection open until Close is called
+func (c *RabbitMQConnection) run() {
+	delay := reconnectMinDelay
+
+	for {
+		conn, err := amqp.Dial(c.url)
+		if err == nil {
+			err = c.setup(conn)
+			if err != nil {
+				conn.Close()
+			}
+		}
+
+		if err != nil {
+			log.Printf("rabbitmq: failed to connect, retrying in %s: %s", delay, err)
+
+			select {
+			case <-c.done:
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+
+			continue
+		}
+
+		delay = reconnectMinDelay
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+
+		log.Println("rabbitmq: connected")
+
+		select {
+		case <-c.done:
+			return
+		case err := <-closed:
+			log.Printf("rabbitmq: connection lost: %v", err)
+		}
+
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+
+		c.drainPool()
+	}
 }
 
-func (c *RabbitMQConnection) PublishJSONMessage(queueName string, message interface{}) error {
-	ch, err := c.Conn.Channel()
+// setup declares the exchanges and queues used by the service
+func (c *RabbitMQConnection) setup(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
 
-	q, err := ch.QueueDeclare(
-		queueName, // queue name
-		false,     // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
+	err = declareEmailQueues(ch)
 	if err != nil {
 		return err
 	}
 
-	jsonMessage, err := json.Marshal(message)
-	if err != nil {
-		return err
+	if c.eventsExchange == "" {
+		return nil
 	}
 
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        jsonMessage,
-		})
-	if err != nil {
-		return err
+	return ch.ExchangeDeclare(
+		c.eventsExchange, // name
+		"topic",          // kind
+		true,             // durable
+		false,            // delete when unused
+		false,            // internal
+		false,            // no-wait
+		nil,              // arguments
+	)
+}
+
+// current returns the open connection, if any
+func (c *RabbitMQConnection) current() (*amqp.Connection, error) {
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	default:
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.conn == nil {
+		return nil, ErrNotConnected
 	}
 
-	return nil
+	return c.conn, nil
 }
 
-// PublishEmailMessage publishes an email verification message to RabbitMQ
-func (c *RabbitMQConnection) PublishEmailMessage(to string, from string, subject string, tempateName string, variables map[string]string) error {
-	ch, err := c.Conn.Channel()
+// Channel opens a new RabbitMQ channel, the caller closes it
+func (c *RabbitMQConnection) Channel() (*amqp.Channel, error) {
+	conn, err := c.current()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer ch.Close()
 
-	fromEmail := mail.Address{
-		Name:    "Mi Tour",
-		Address: from,
-	}
-	toEmail := mail.Address{
-		Name:    "",
-		Address: to,
+	return conn.Channel()
+}
+
+// getChannel takes a publisher channel from the pool or opens a new one
+func (c *RabbitMQConnection) getChannel() (*publisherChannel, error) {
+	conn, err := c.current()
+	if err != nil {
+		return nil, err
 	}
 
-	headers := map[string]string{
-		"From":         fromEmail.String(),
-		"To":           toEmail.String(),
-		"Subject":      subject,
-		"Content-Type": "text/html; charset=UTF-8",
+	for {
+		var pc *publisherChannel
+
+		select {
+		case pc = <-c.pool:
+		default:
+		}
+
+		if pc == nil {
+			break
+		}
+
+		if pc.conn == conn {
+			return pc, nil
+		}
+
+		// Left over from a previous connection
+		pc.ch.Close()
 	}
 
-	message := bytes.Buffer{}
-	for k, v := range headers {
-		message.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
 	}
 
-	tmpl, err := template.ParseFiles("templates/" + tempateName + ".html")
+	err = ch.Confirm(false)
 	if err != nil {
-		return err
+		ch.Close()
+		return nil, err
 	}
 
-	if err := tmpl.Execute(&message, variables); err != nil {
-		return err
+	return &publisherChannel{
+		conn:     conn,
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, 1)),
+	}, nil
+}
+
+// putChannel returns a publisher channel to the pool, closing it if the
+// pool is full or the connection changed
+func (c *RabbitMQConnection) putChannel(pc *publisherChannel) {
+	if conn, err := c.current(); err != nil || conn != pc.conn {
+		pc.ch.Close()
+		return
 	}
 
-	q, err := ch.QueueDeclare(
-		"email_queue", // queue name
-		false,         // durable
-		false,         // delete when unused
-		false,         // exclusive
-		false,         // no-wait
-		nil,           // arguments
-	)
-	if err != nil {
-		return err
+	select {
+	case c.pool <- pc:
+	default:
+		pc.ch.Close()
 	}
+}
 
-	msg := models.EmailMessage{
-		To:        to,
-		From:      from,
-		Subject:   subject,
-		Headers:   headers,
-		Body:      message.String(),
-		Variables: variables,
+// drainPool closes the idle publisher channels
+func (c *RabbitMQConnection) drainPool() {
+	for {
+		select {
+		case pc := <-c.pool:
+			pc.ch.Close()
+		default:
+			return
+		}
 	}
+}
 
-	jsonMsg, err := json.Marshal(msg)
+// Publish publishes a message and waits for the broker to confirm it
+func (c *RabbitMQConnection) Publish(exchange string, key string, msg amqp.Publishing) error {
+	pc, err := c.getChannel()
 	if err != nil {
-		log.Fatalf("Failed to marshal message: %s", err)
+		return err
 	}
 
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        jsonMsg,
-		})
+	err = pc.ch.Publish(exchange, key, false, false, msg)
 	if err != nil {
+		pc.ch.Close()
 		return err
 	}
 
-	return nil
-}
-
-// ConsumeEmailMessage consumes an email verification message from RabbitMQ
-func (c *RabbitMQConnection) ConsumeEmailMessage(sendEmail func(message, toEmail, fromEmail string) error) error {
-	for {
-		ch, err := c.Conn.Channel()
-		if err != nil {
-			log.Printf("Failed to open a channel: %s", err)
-			time.Sleep(time.Second)
-			continue
+	select {
+	case confirm, ok := <-pc.confirms:
+		if !ok {
+			return ErrNotConnected
 		}
 
-		q, err := ch.QueueDeclare(
-			"email_queue", // queue name
-			false,         // durable
-			false,         // delete when unused
-			false,         // exclusive
-			false,         // no-wait
-			nil,           // arguments
-		)
-		if err != nil {
-			log.Printf("Failed to declare a queue: %s", err)
-			time.Sleep(time.Second)
-			continue
+		c.putChannel(pc)
+
+		if !confirm.Ack {
+			return ErrNacked
 		}
 
-		msgs, err := ch.Consume(
-			q.Name, // queue
-			"",     // consumer
-			true,   // auto-ack
-			false,  // exclusive
-			false,  // no-local
-			false,  // no-wait
-			nil,    // args
-		)
-		if err != nil {
-			log.Printf("Failed to consume messages: %s", err)
-			time.Sleep(time.Second)
-			continue
+		return nil
+	case <-time.After(ConfirmTimeout):
+		// A late confirm would be read by the next publisher, drop the channel
+		pc.ch.Close()
+		return errors.New("rabbitmq: timed out waiting for the publish confirm")
+	}
+}
+
+// Close stops the consumers, waiting for the messages being handled, then
+// closes the channels and the connection
+func (c *RabbitMQConnection) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		stopped := make(chan struct{})
+		go func() {
+			c.consumers.Wait()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			log.Println("rabbitmq: timed out waiting for the consumers")
 		}
 
-		for msg := range msgs {
-			var email models.EmailMessage
-			err := json.Unmarshal(msg.Body, &email)
-			if err != nil {
-				log.Printf("failed to unmarshal message: %s", err)
-				continue
-			}
+		c.drainPool()
 
-			to := email.To
-			from := email.From
-			body := email.Body
+		c.mu.Lock()
+		defer c.mu.Unlock()
 
-			if from != "" || to != "" {
-				if err := sendEmail(to, from, body); err != nil {
-					log.Printf("Failed to send email: %s", err)
-				}
-				// Acknowledge the message to remove it from the queue
-				msg.Ack(false)
-			}
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
 		}
+	})
+}
 
-		ch.Close()
+// PublishEvent publishes a domain event to the events exchange, routed by
+// its type. Events may be delivered more than once, consumers deduplicate
+// them by id
+func (c *RabbitMQConnection) PublishEvent(event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
 	}
+
+	return c.Publish(
+		c.eventsExchange, // exchange
+		event.Type,       // routing key
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    event.Id,
+			Type:         event.Type,
+			Timestamp:    event.OccurredAt,
+			Body:         body,
+		})
 }
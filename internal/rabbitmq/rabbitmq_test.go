@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tapiaw38/auth-api/internal/mailer"
+)
+
+func TestConnection(t *testing.T) {
+	// Nothing listens on this port, the broker is unreachable
+	conf := NewRabbitMQConfig(&RabbitMQConfig{
+		Host:     "127.0.0.1",
+		Port:     "1",
+		User:     "guest",
+		Password: "guest",
+	})
+
+	t.Run("should not block nor exit when the broker is unreachable", func(t *testing.T) {
+		conn := conf.Connection()
+		assert.Same(t, conn, conf.Connection())
+
+		err := conn.Publish("", EmailQueue, amqp.Publishing{Body: []byte("{}")})
+		assert.ErrorIs(t, err, ErrNotConnected)
+	})
+
+	t.Run("should stop the consumers on close", func(t *testing.T) {
+		conn := conf.Connection()
+
+		stopped := make(chan error)
+		go func() {
+			stopped <- conn.ConsumeEmailMessage(mailer.NewLogSender())
+		}()
+
+		conn.Close()
+
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("consumer did not stop")
+		}
+
+		_, err := conn.Channel()
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
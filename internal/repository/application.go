@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertApplication(ctx context.Context, application *models.Application) (*models.Application, error) {
+	return implementation.InsertApplication(ctx, application)
+}
+
+func GetApplicationById(ctx context.Context, id string) (*models.Application, error) {
+	return implementation.GetApplicationById(ctx, id)
+}
+
+func ListApplication(ctx context.Context) ([]*models.Application, error) {
+	return implementation.ListApplication(ctx)
+}
+
+func UpdateApplication(ctx context.Context, application *models.Application) (*models.Application, error) {
+	return implementation.UpdateApplication(ctx, application)
+}
+
+func DeleteApplication(ctx context.Context, id string) error {
+	err := implementation.DeleteApplication(ctx, id)
+	if err == nil {
+		invalidateUsers(ctx)
+	}
+
+	return err
+}
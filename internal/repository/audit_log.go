@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertAuditLog(ctx context.Context, auditLog *models.AuditLog) error {
+	return implementation.InsertAuditLog(ctx, auditLog)
+}
+
+func ListAuditLog(ctx context.Context, filter *models.AuditLogFilter) ([]*models.AuditLog, error) {
+	return implementation.ListAuditLog(ctx, filter)
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Invalidator drops the cached data made stale by a write
+type Invalidator interface {
+	// InvalidateUser drops the cache of a single user and of the listings
+	InvalidateUser(userId string) error
+	// InvalidateUsers drops the cache of every user and of the listings
+	InvalidateUsers() error
+}
+
+var invalidator Invalidator
+
+// SetInvalidator sets the cache notified of the writes of the repository
+func SetInvalidator(i Invalidator) {
+	invalidator = i
+}
+
+// pendingKey is the context key of the invalidations of a transaction
+type pendingKey struct{}
+
+// pending holds the invalidations to run once a transaction is committed
+type pending struct {
+	sync.Mutex
+	fns []func(Invalidator) error
+}
+
+// flush runs the invalidations, a failure is only logged
+func (p *pending) flush() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, fn := range p.fns {
+		if err := fn(invalidator); err != nil {
+			log.Println(err)
+		}
+	}
+
+	p.fns = nil
+}
+
+// invalidate runs fn at once, or after the commit when the context carries
+// a transaction, so that a concurrent read cannot cache the old data again
+func invalidate(ctx context.Context, fn func(Invalidator) error) {
+	if invalidator == nil {
+		return
+	}
+
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.Lock()
+		p.fns = append(p.fns, fn)
+		p.Unlock()
+		return
+	}
+
+	if err := fn(invalidator); err != nil {
+		log.Println(err)
+	}
+}
+
+// invalidateUser drops the cache of a single user once the write is done
+func invalidateUser(ctx context.Context, userId string) {
+	invalidate(ctx, func(i Invalidator) error {
+		return i.InvalidateUser(userId)
+	})
+}
+
+// invalidateUsers drops the cache of every user once the write is done
+func invalidateUsers(ctx context.Context) {
+	invalidate(ctx, func(i Invalidator) error {
+		return i.InvalidateUsers()
+	})
+}
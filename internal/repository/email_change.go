@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertEmailChange(ctx context.Context, emailChange *models.EmailChange) (*models.EmailChange, error) {
+	return implementation.InsertEmailChange(ctx, emailChange)
+}
+
+func GetEmailChangeByUserId(ctx context.Context, userId string) (*models.EmailChange, error) {
+	return implementation.GetEmailChangeByUserId(ctx, userId)
+}
+
+func ConfirmEmailChange(ctx context.Context, id string) error {
+	return implementation.ConfirmEmailChange(ctx, id)
+}
+
+func DeleteEmailChange(ctx context.Context, id string) error {
+	return implementation.DeleteEmailChange(ctx, id)
+}
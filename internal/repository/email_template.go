@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func UpsertEmailTemplate(ctx context.Context, template *models.EmailTemplate) (*models.EmailTemplate, error) {
+	return implementation.UpsertEmailTemplate(ctx, template)
+}
+
+func GetEmailTemplate(ctx context.Context, name string, locale string, templateSet string) (*models.EmailTemplate, error) {
+	return implementation.GetEmailTemplate(ctx, name, locale, templateSet)
+}
+
+func ListEmailTemplate(ctx context.Context) ([]*models.EmailTemplate, error) {
+	return implementation.ListEmailTemplate(ctx)
+}
+
+func ListEmailTemplateByName(ctx context.Context, name string) ([]*models.EmailTemplate, error) {
+	return implementation.ListEmailTemplateByName(ctx, name)
+}
+
+func DeleteEmailTemplate(ctx context.Context, name string, locale string, templateSet string) error {
+	return implementation.DeleteEmailTemplate(ctx, name, locale, templateSet)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error) {
+	return implementation.InsertInvitation(ctx, invitation)
+}
+
+func GetInvitationById(ctx context.Context, id string) (*models.Invitation, error) {
+	return implementation.GetInvitationById(ctx, id)
+}
+
+func GetPendingInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	return implementation.GetPendingInvitationByTokenHash(ctx, tokenHash)
+}
+
+func ListPendingInvitation(ctx context.Context) ([]*models.Invitation, error) {
+	return implementation.ListPendingInvitation(ctx)
+}
+
+func RevokeInvitation(ctx context.Context, id string) error {
+	return implementation.RevokeInvitation(ctx, id)
+}
+
+func AcceptInvitation(ctx context.Context, id string, userId string) (bool, error) {
+	return implementation.AcceptInvitation(ctx, id, userId)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertOneTimeToken(ctx context.Context, token *models.OneTimeToken) error {
+	return implementation.InsertOneTimeToken(ctx, token)
+}
+
+func GetOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	return implementation.GetOneTimeToken(ctx, purpose, tokenHash)
+}
+
+func ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error) {
+	return implementation.ConsumeOneTimeToken(ctx, purpose, tokenHash)
+}
+
+func DeleteOneTimeTokens(ctx context.Context, userId string, purpose string) error {
+	return implementation.DeleteOneTimeTokens(ctx, userId, purpose)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error) {
+	return implementation.InsertOrganization(ctx, organization)
+}
+
+func GetOrganizationById(ctx context.Context, id string) (*models.Organization, error) {
+	return implementation.GetOrganizationById(ctx, id)
+}
+
+func GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	return implementation.GetOrganizationBySlug(ctx, slug)
+}
+
+func UpdateOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error) {
+	return implementation.UpdateOrganization(ctx, organization)
+}
+
+func InsertMembership(ctx context.Context, membership *models.Membership) (*models.Membership, error) {
+	return implementation.InsertMembership(ctx, membership)
+}
+
+func GetMembership(ctx context.Context, organizationId string, userId string) (*models.Membership, error) {
+	return implementation.GetMembership(ctx, organizationId, userId)
+}
+
+func ListMembership(ctx context.Context, organizationId string) ([]*models.Membership, error) {
+	return implementation.ListMembership(ctx, organizationId)
+}
+
+func ListUserMembership(ctx context.Context, userId string) ([]*models.Membership, error) {
+	return implementation.ListUserMembership(ctx, userId)
+}
+
+func UpdateMembershipStatus(ctx context.Context, organizationId string, userId string, status string) error {
+	return implementation.UpdateMembershipStatus(ctx, organizationId, userId, status)
+}
+
+func DeleteMembership(ctx context.Context, organizationId string, userId string) error {
+	return implementation.DeleteMembership(ctx, organizationId, userId)
+}
+
+func CountMembersWithRole(ctx context.Context, organizationId string, roleName string) (int, error) {
+	return implementation.CountMembersWithRole(ctx, organizationId, roleName)
+}
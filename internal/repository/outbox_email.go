@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertOutboxEmail(ctx context.Context, id string, message *models.EmailMessage) error {
+	return implementation.InsertOutboxEmail(ctx, id, message)
+}
+
+func ClaimOutboxEmails(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEmail, error) {
+	return implementation.ClaimOutboxEmails(ctx, limit, lease)
+}
+
+func DeleteOutboxEmail(ctx context.Context, id string) error {
+	return implementation.DeleteOutboxEmail(ctx, id)
+}
+
+func MarkOutboxEmailFailed(ctx context.Context, id string, reason string) error {
+	return implementation.MarkOutboxEmailFailed(ctx, id, reason)
+}
+
+func ReleaseOutboxEmails(ctx context.Context, ids []string) error {
+	return implementation.ReleaseOutboxEmails(ctx, ids)
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertOutboxEvent(ctx context.Context, event *models.Event) error {
+	return implementation.InsertOutboxEvent(ctx, event)
+}
+
+func ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.Event, error) {
+	return implementation.ClaimOutboxEvents(ctx, limit, lease)
+}
+
+func MarkOutboxEventPublished(ctx context.Context, id string) error {
+	return implementation.MarkOutboxEventPublished(ctx, id)
+}
+
+func MarkOutboxEventFailed(ctx context.Context, id string, reason string) error {
+	return implementation.MarkOutboxEventFailed(ctx, id, reason)
+}
+
+func ReleaseOutboxEvents(ctx context.Context, ids []string) error {
+	return implementation.ReleaseOutboxEvents(ctx, ids)
+}
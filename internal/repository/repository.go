@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/tapiaw38/auth-api/internal/models"
 )
@@ -11,12 +12,93 @@ type Repository interface {
 	// User
 	InsertUser(ctx context.Context, user *models.User) (*models.User, error)
 	GetUserById(ctx context.Context, id string) (*models.User, error)
-	GetUserByVerifiedEmailToken(ctx context.Context, token string) (*models.User, error)
-	GetUserByPasswordResetToken(ctx context.Context, token string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	UpdateUser(ctx context.Context, id string, user *models.User) (*models.User, error)
 	PartialUpdateUser(ctx context.Context, id string, updates map[string]interface{}) (*models.User, error)
-	ListUser(ctx context.Context, page int, limit int) ([]*models.User, error)
+	GetUserTokenVersion(ctx context.Context, id string) (int, error)
+	IncrementTokenVersion(ctx context.Context, id string) (int, error)
+	DeleteUser(ctx context.Context, id string) error
+	ListUser(ctx context.Context, filter *models.UserFilter) ([]*models.User, int, error)
+	// Email Change
+	InsertEmailChange(ctx context.Context, emailChange *models.EmailChange) (*models.EmailChange, error)
+	GetEmailChangeByUserId(ctx context.Context, userId string) (*models.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, id string) error
+	DeleteEmailChange(ctx context.Context, id string) error
+	// One Time Token
+	InsertOneTimeToken(ctx context.Context, token *models.OneTimeToken) error
+	GetOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*models.OneTimeToken, error)
+	DeleteOneTimeTokens(ctx context.Context, userId string, purpose string) error
+	// Session
+	InsertSession(ctx context.Context, session *models.Session) (*models.Session, error)
+	GetSessionById(ctx context.Context, id string) (*models.Session, error)
+	GetSessionByTokenFamily(ctx context.Context, family string) (*models.Session, error)
+	RotateSessionRefreshToken(ctx context.Context, id string, tokenHash string, expiresAt time.Time) error
+	ListSession(ctx context.Context, userId string) ([]*models.Session, error)
+	TouchSession(ctx context.Context, id string, userId string) (bool, error)
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userId string, exceptId string) error
+	SetSessionOrganization(ctx context.Context, id string, organizationId string) error
+	// Audit Log
+	InsertAuditLog(ctx context.Context, auditLog *models.AuditLog) error
+	ListAuditLog(ctx context.Context, filter *models.AuditLogFilter) ([]*models.AuditLog, error)
+	// Outbox Event
+	InsertOutboxEvent(ctx context.Context, event *models.Event) error
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.Event, error)
+	MarkOutboxEventPublished(ctx context.Context, id string) error
+	MarkOutboxEventFailed(ctx context.Context, id string, reason string) error
+	ReleaseOutboxEvents(ctx context.Context, ids []string) error
+	// Outbox Email
+	InsertOutboxEmail(ctx context.Context, id string, message *models.EmailMessage) error
+	ClaimOutboxEmails(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEmail, error)
+	DeleteOutboxEmail(ctx context.Context, id string) error
+	MarkOutboxEmailFailed(ctx context.Context, id string, reason string) error
+	ReleaseOutboxEmails(ctx context.Context, ids []string) error
+	// Webhook
+	InsertWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error)
+	GetWebhookById(ctx context.Context, id string) (*models.Webhook, error)
+	ListWebhook(ctx context.Context) ([]*models.Webhook, error)
+	ListWebhookByEventType(ctx context.Context, eventType string) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	// Webhook Delivery
+	InsertWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetWebhookDeliveryById(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	ListWebhookDelivery(ctx context.Context, webhookId string, limit int) ([]*models.WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Email Template
+	UpsertEmailTemplate(ctx context.Context, template *models.EmailTemplate) (*models.EmailTemplate, error)
+	GetEmailTemplate(ctx context.Context, name string, locale string, templateSet string) (*models.EmailTemplate, error)
+	ListEmailTemplate(ctx context.Context) ([]*models.EmailTemplate, error)
+	ListEmailTemplateByName(ctx context.Context, name string) ([]*models.EmailTemplate, error)
+	DeleteEmailTemplate(ctx context.Context, name string, locale string, templateSet string) error
+	// Application
+	InsertApplication(ctx context.Context, application *models.Application) (*models.Application, error)
+	GetApplicationById(ctx context.Context, id string) (*models.Application, error)
+	ListApplication(ctx context.Context) ([]*models.Application, error)
+	UpdateApplication(ctx context.Context, application *models.Application) (*models.Application, error)
+	DeleteApplication(ctx context.Context, id string) error
+	// Organization
+	InsertOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error)
+	GetOrganizationById(ctx context.Context, id string) (*models.Organization, error)
+	GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	UpdateOrganization(ctx context.Context, organization *models.Organization) (*models.Organization, error)
+	InsertMembership(ctx context.Context, membership *models.Membership) (*models.Membership, error)
+	GetMembership(ctx context.Context, organizationId string, userId string) (*models.Membership, error)
+	ListMembership(ctx context.Context, organizationId string) ([]*models.Membership, error)
+	ListUserMembership(ctx context.Context, userId string) ([]*models.Membership, error)
+	UpdateMembershipStatus(ctx context.Context, organizationId string, userId string, status string) error
+	DeleteMembership(ctx context.Context, organizationId string, userId string) error
+	CountMembersWithRole(ctx context.Context, organizationId string, roleName string) (int, error)
+	// Invitation
+	InsertInvitation(ctx context.Context, invitation *models.Invitation) (*models.Invitation, error)
+	GetInvitationById(ctx context.Context, id string) (*models.Invitation, error)
+	GetPendingInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	ListPendingInvitation(ctx context.Context) ([]*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, id string) error
+	AcceptInvitation(ctx context.Context, id string, userId string) (bool, error)
 	// Role
 	EnsureRole() error
 	InsertRole(ctx context.Context, role *models.Role) (*models.Role, error)
@@ -29,6 +111,7 @@ type Repository interface {
 	InsertUserRole(ctx context.Context, userRole *models.UserRole) error
 	DeleteUserRole(ctx context.Context, userRole *models.UserRole) error
 
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
 	Close() error
 }
 
@@ -37,3 +120,22 @@ var implementation Repository
 func SetRepository(repository Repository) {
 	implementation = repository
 }
+
+// WithTx runs fn in a transaction joined by the repository calls made with its context.
+// The cache invalidated by its writes is dropped once it is committed
+func WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		return implementation.WithTx(ctx, fn)
+	}
+
+	p := &pending{}
+
+	err := implementation.WithTx(context.WithValue(ctx, pendingKey{}, p), fn)
+	if err != nil {
+		return err
+	}
+
+	p.flush()
+
+	return nil
+}
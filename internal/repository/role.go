@@ -23,11 +23,21 @@ func GetRoleByName(ctx context.Context, name string) (*models.Role, error) {
 }
 
 func UpdateRole(ctx context.Context, role *models.Role) (*models.Role, error) {
-	return implementation.UpdateRole(ctx, role)
+	r, err := implementation.UpdateRole(ctx, role)
+	if err == nil {
+		invalidateUsers(ctx)
+	}
+
+	return r, err
 }
 
 func DeleteRole(ctx context.Context, id string) (*models.Role, error) {
-	return implementation.DeleteRole(ctx, id)
+	r, err := implementation.DeleteRole(ctx, id)
+	if err == nil {
+		invalidateUsers(ctx)
+	}
+
+	return r, err
 }
 
 func ListRole(ctx context.Context) ([]*models.Role, error) {
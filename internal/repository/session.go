@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	return implementation.InsertSession(ctx, session)
+}
+
+func GetSessionById(ctx context.Context, id string) (*models.Session, error) {
+	return implementation.GetSessionById(ctx, id)
+}
+
+func GetSessionByTokenFamily(ctx context.Context, family string) (*models.Session, error) {
+	return implementation.GetSessionByTokenFamily(ctx, family)
+}
+
+func RotateSessionRefreshToken(ctx context.Context, id string, tokenHash string, expiresAt time.Time) error {
+	return implementation.RotateSessionRefreshToken(ctx, id, tokenHash, expiresAt)
+}
+
+func ListSession(ctx context.Context, userId string) ([]*models.Session, error) {
+	return implementation.ListSession(ctx, userId)
+}
+
+func TouchSession(ctx context.Context, id string, userId string) (bool, error) {
+	return implementation.TouchSession(ctx, id, userId)
+}
+
+func RevokeSession(ctx context.Context, id string) error {
+	return implementation.RevokeSession(ctx, id)
+}
+
+func RevokeUserSessions(ctx context.Context, userId string, exceptId string) error {
+	return implementation.RevokeUserSessions(ctx, userId, exceptId)
+}
+
+func SetSessionOrganization(ctx context.Context, id string, organizationId string) error {
+	return implementation.SetSessionOrganization(ctx, id, organizationId)
+}
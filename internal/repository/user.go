@@ -7,35 +7,68 @@ import (
 )
 
 func InsertUser(ctx context.Context, user *models.User) (*models.User, error) {
-	return implementation.InsertUser(ctx, user)
+	u, err := implementation.InsertUser(ctx, user)
+	if err == nil {
+		invalidateUser(ctx, user.Id)
+	}
+
+	return u, err
 }
 
 func GetUserById(ctx context.Context, id string) (*models.User, error) {
 	return implementation.GetUserById(ctx, id)
 }
 
-func GetUserByVerifiedEmailToken(ctx context.Context, token string) (*models.User, error) {
-	return implementation.GetUserByVerifiedEmailToken(ctx, token)
-}
-
-func GetUserByPasswordResetToken(ctx context.Context, token string) (*models.User, error) {
-	return implementation.GetUserByPasswordResetToken(ctx, token)
-}
-
 func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	return implementation.GetUserByEmail(ctx, email)
 }
 
+func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return implementation.GetUserByUsername(ctx, username)
+}
+
 func UpdateUser(ctx context.Context, id string, user *models.User) (*models.User, error) {
-	return implementation.UpdateUser(ctx, id, user)
+	u, err := implementation.UpdateUser(ctx, id, user)
+	if err == nil {
+		invalidateUser(ctx, id)
+	}
+
+	return u, err
 }
 
 func PartialUpdateUser(ctx context.Context, id string, updates map[string]interface{}) (*models.User, error) {
-	return implementation.PartialUpdateUser(ctx, id, updates)
+	u, err := implementation.PartialUpdateUser(ctx, id, updates)
+	if err == nil {
+		invalidateUser(ctx, id)
+	}
+
+	return u, err
+}
+
+func GetUserTokenVersion(ctx context.Context, id string) (int, error) {
+	return implementation.GetUserTokenVersion(ctx, id)
+}
+
+func IncrementTokenVersion(ctx context.Context, id string) (int, error) {
+	version, err := implementation.IncrementTokenVersion(ctx, id)
+	if err == nil {
+		invalidateUser(ctx, id)
+	}
+
+	return version, err
+}
+
+func DeleteUser(ctx context.Context, id string) error {
+	err := implementation.DeleteUser(ctx, id)
+	if err == nil {
+		invalidateUser(ctx, id)
+	}
+
+	return err
 }
 
-func ListUser(ctx context.Context, page int, limit int) ([]*models.User, error) {
-	return implementation.ListUser(ctx, page, limit)
+func ListUser(ctx context.Context, filter *models.UserFilter) ([]*models.User, int, error) {
+	return implementation.ListUser(ctx, filter)
 }
 
 func Close() error {
@@ -7,9 +7,19 @@ import (
 )
 
 func InsertUserRole(ctx context.Context, userRole *models.UserRole) error {
-	return implementation.InsertUserRole(ctx, userRole)
+	err := implementation.InsertUserRole(ctx, userRole)
+	if err == nil {
+		invalidateUser(ctx, userRole.UserId)
+	}
+
+	return err
 }
 
 func DeleteUserRole(ctx context.Context, userRole *models.UserRole) error {
-	return implementation.DeleteUserRole(ctx, userRole)
+	err := implementation.DeleteUserRole(ctx, userRole)
+	if err == nil {
+		invalidateUser(ctx, userRole.UserId)
+	}
+
+	return err
 }
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func InsertWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	return implementation.InsertWebhook(ctx, webhook)
+}
+
+func GetWebhookById(ctx context.Context, id string) (*models.Webhook, error) {
+	return implementation.GetWebhookById(ctx, id)
+}
+
+func ListWebhook(ctx context.Context) ([]*models.Webhook, error) {
+	return implementation.ListWebhook(ctx)
+}
+
+func ListWebhookByEventType(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	return implementation.ListWebhookByEventType(ctx, eventType)
+}
+
+func UpdateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	return implementation.UpdateWebhook(ctx, webhook)
+}
+
+func DeleteWebhook(ctx context.Context, id string) error {
+	return implementation.DeleteWebhook(ctx, id)
+}
+
+func InsertWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return implementation.InsertWebhookDelivery(ctx, delivery)
+}
+
+func GetWebhookDeliveryById(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	return implementation.GetWebhookDeliveryById(ctx, id)
+}
+
+func ListWebhookDelivery(ctx context.Context, webhookId string, limit int) ([]*models.WebhookDelivery, error) {
+	return implementation.ListWebhookDelivery(ctx, webhookId, limit)
+}
+
+func ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	return implementation.ClaimWebhookDeliveries(ctx, limit, lease)
+}
+
+func UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return implementation.UpdateWebhookDelivery(ctx, delivery)
+}
@@ -14,29 +14,112 @@ func BinderRoutes(s server.Server, router *gin.Engine) {
 	authRoute.POST("signup", handlers.SignUpHandler(s))
 	authRoute.POST("login", handlers.LoginHandler(s))
 	authRoute.GET("verify-email", handlers.VerifiedEmailHandler(s))
+	authRoute.POST("verify-email/resend", handlers.ResendVerificationEmailHandler(s))
 	authRoute.POST("reset-password", handlers.ResetPasswordHandler(s))
 	authRoute.POST("change-password", handlers.ChangePasswordHandler(s))
+	authRoute.GET("confirm-email-change", handlers.ConfirmEmailChangeHandler(s))
+	authRoute.GET("cancel-email-change", handlers.CancelEmailChangeHandler(s))
+	authRoute.POST("accept-invitation", handlers.AcceptUserInvitationHandler(s))
+	authRoute.POST("refresh", middleware.CSRFMiddleware(), handlers.RefreshTokenHandler(s))
+	authRoute.POST("logout", middleware.CSRFMiddleware(), handlers.LogoutHandler(s))
 
 	// mount the middleware
 	router.Use(middleware.CheckAuthMiddleware(s))
+	router.Use(middleware.CSRFMiddleware())
 
 	// User routes
 	userRoute := router.Group("/users/")
 	userRoute.GET("me", handlers.MeHandler(s))
+	userRoute.PUT("me/password", handlers.UpdatePasswordHandler(s))
 	userRoute.PUT(":id", handlers.UpdateUserHandler(s))
 	userRoute.PUT("picture/:id", handlers.UploadPictureHandler(s))
-	userRoute.GET("list", handlers.ListUserHandler(s))
+	userRoute.GET("list", middleware.RequireVerifiedEmail(s), handlers.ListUserHandler(s))
 
-	// Role routes
-	roleRoute := router.Group("/roles/")
+	// Session routes
+	userRoute.GET("me/sessions", handlers.ListMySessionHandler(s))
+	userRoute.DELETE("me/sessions/:id", handlers.RevokeMySessionHandler(s))
+	userRoute.GET(":id/sessions", middleware.RequireRole("superadmin"), handlers.ListUserSessionHandler(s))
+	userRoute.DELETE(":id/sessions/:session_id", middleware.RequireRole("superadmin"), handlers.RevokeUserSessionHandler(s))
+
+	// Admin user routes. They act on every tenant and are restricted to the
+	// superadmins, the admins of an organization manage its members under
+	// /organizations/current
+	adminUserRoute := router.Group("/admin/users/", middleware.RequireRole("superadmin"))
+	adminUserRoute.GET(":id", handlers.AdminGetUserHandler(s))
+	adminUserRoute.PUT(":id", handlers.AdminUpdateUserHandler(s))
+	adminUserRoute.POST(":id/activate", handlers.AdminActivateUserHandler(s))
+	adminUserRoute.POST(":id/deactivate", handlers.AdminDeactivateUserHandler(s))
+	adminUserRoute.POST(":id/password-reset", handlers.AdminForcePasswordResetHandler(s))
+	adminUserRoute.DELETE(":id", handlers.AdminDeleteUserHandler(s))
+
+	// Role routes, global and restricted to the superadmins
+	roleRoute := router.Group("/roles/", middleware.RequireVerifiedEmail(s), middleware.RequireRole("superadmin"))
 	roleRoute.POST("new", handlers.InsertRoleHandler(s))
 	roleRoute.GET("list", handlers.ListRoleHandler(s))
 	roleRoute.GET(":id", handlers.GetRoleByIdHandler(s))
 	roleRoute.PUT(":id", handlers.UpdateRoleHandler(s))
 	roleRoute.DELETE(":id", handlers.DeleteRoleHandler(s))
 
-	// User Role routes
-	userRoleRoute := router.Group("/user_roles/")
+	// User Role routes, global and restricted to the superadmins
+	userRoleRoute := router.Group("/user_roles/", middleware.RequireVerifiedEmail(s), middleware.RequireRole("superadmin"))
 	userRoleRoute.POST("new", handlers.InsertUserRole(s))
 	userRoleRoute.DELETE("delete", handlers.DeleteUserRole(s))
+
+	// Organization routes, the current organization is the one selected by the token
+	organizationRoute := router.Group("/organizations/", middleware.RequireVerifiedEmail(s))
+	organizationRoute.POST("new", handlers.InsertOrganizationHandler(s))
+	organizationRoute.GET("mine", handlers.ListMyOrganizationHandler(s))
+	organizationRoute.POST("switch", handlers.SwitchOrganizationHandler(s))
+	organizationRoute.POST(":id/accept", handlers.AcceptInvitationHandler(s))
+	organizationRoute.DELETE(":id/membership", handlers.LeaveOrganizationHandler(s))
+
+	orgMember := middleware.RequireOrganization()
+	orgAdmin := middleware.RequireOrganization(handlers.OrganizationAdminRole)
+	organizationRoute.GET("current", orgMember, handlers.GetCurrentOrganizationHandler(s))
+	organizationRoute.PUT("current", orgAdmin, handlers.UpdateCurrentOrganizationHandler(s))
+	organizationRoute.GET("current/members", orgMember, handlers.ListMemberHandler(s))
+	organizationRoute.POST("current/invitations", orgAdmin, handlers.InviteMemberHandler(s))
+	organizationRoute.DELETE("current/members/:user_id", orgAdmin, handlers.RemoveMemberHandler(s))
+	organizationRoute.POST("current/members/:user_id/roles", orgAdmin, handlers.GrantMemberRoleHandler(s))
+	organizationRoute.DELETE("current/members/:user_id/roles/:role_id", orgAdmin, handlers.RevokeMemberRoleHandler(s))
+
+	// Webhook routes
+	webhookRoute := router.Group("/webhooks/", middleware.RequireRole("superadmin", "admin"))
+	webhookRoute.POST("new", handlers.InsertWebhookHandler(s))
+	webhookRoute.GET("list", handlers.ListWebhookHandler(s))
+	webhookRoute.GET(":id", handlers.GetWebhookByIdHandler(s))
+	webhookRoute.PUT(":id", handlers.UpdateWebhookHandler(s))
+	webhookRoute.DELETE(":id", handlers.DeleteWebhookHandler(s))
+	webhookRoute.GET(":id/deliveries", handlers.ListWebhookDeliveryHandler(s))
+	webhookRoute.POST(":id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhookHandler(s))
+
+	// Invitation routes
+	router.POST("/invitations", middleware.RequireRole("superadmin", "admin"), handlers.InsertInvitationHandler(s))
+	invitationRoute := router.Group("/invitations/", middleware.RequireRole("superadmin", "admin"))
+	invitationRoute.GET("list", handlers.ListInvitationHandler(s))
+	invitationRoute.DELETE(":id", handlers.RevokeInvitationHandler(s))
+
+	// Email routes
+	emailRoute := router.Group("/emails/", middleware.RequireRole("superadmin", "admin"))
+	emailRoute.GET("dead-letters", handlers.ListDeadLetterEmailHandler(s))
+	emailRoute.POST("dead-letters/requeue", handlers.RequeueDeadLetterEmailHandler(s))
+
+	// Application routes
+	applicationRoute := router.Group("/applications/", middleware.RequireRole("superadmin", "admin"))
+	applicationRoute.POST("new", handlers.InsertApplicationHandler(s))
+	applicationRoute.GET("list", handlers.ListApplicationHandler(s))
+	applicationRoute.GET(":id", handlers.GetApplicationByIdHandler(s))
+	applicationRoute.PUT(":id", handlers.UpdateApplicationHandler(s))
+	applicationRoute.DELETE(":id", handlers.DeleteApplicationHandler(s))
+
+	// Email template routes
+	emailTemplateRoute := router.Group("/email-templates/", middleware.RequireRole("superadmin", "admin"))
+	emailTemplateRoute.GET("list", handlers.ListEmailTemplateHandler(s))
+	emailTemplateRoute.GET(":name/:locale", handlers.GetEmailTemplateHandler(s))
+	emailTemplateRoute.PUT(":name/:locale", handlers.UpdateEmailTemplateHandler(s))
+	emailTemplateRoute.DELETE(":name/:locale", handlers.DeleteEmailTemplateHandler(s))
+	emailTemplateRoute.POST(":name/:locale/preview", handlers.PreviewEmailTemplateHandler(s))
+
+	// Audit routes, the log covers every tenant and is restricted to the superadmins
+	router.GET("/audit", middleware.RequireRole("superadmin"), handlers.ListAuditLogHandler(s))
 }
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/tapiaw38/auth-api/config"
+)
+
+// corsRoute is a CORS handler bound to a route prefix
+type corsRoute struct {
+	prefix  string
+	handler gin.HandlerFunc
+}
+
+// newCORSConfig converts a CORS policy into a cors configuration
+func newCORSConfig(policy config.CORSPolicy) (cors.Config, error) {
+	conf := cors.Config{
+		AllowMethods:     policy.AllowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    policy.ExposeHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           policy.MaxAge,
+		AllowWildcard:    true,
+	}
+
+	if allowsAnyOrigin(policy) {
+		conf.AllowAllOrigins = true
+	} else {
+		conf.AllowOrigins = policy.AllowOrigins
+	}
+
+	return conf, conf.Validate()
+}
+
+// allowsAnyOrigin reports whether a policy accepts every origin, which it
+// does when none is listed
+func allowsAnyOrigin(policy config.CORSPolicy) bool {
+	if len(policy.AllowOrigins) == 0 {
+		return true
+	}
+
+	for _, origin := range policy.AllowOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateCORSPolicies refuses a policy accepting every origin while it
+// allows credentials, or while the session lives in cookies. Browsers reject
+// such answers, and reflecting any origin instead would expose the session
+func validateCORSPolicies(cookieMode bool, defaultPolicy config.CORSPolicy, groups []config.CORSPolicy) error {
+	for _, policy := range append([]config.CORSPolicy{defaultPolicy}, groups...) {
+		if allowsAnyOrigin(policy) && (policy.AllowCredentials || cookieMode) {
+			name := "default"
+			if len(policy.Paths) > 0 {
+				name = strings.Join(policy.Paths, ", ")
+			}
+
+			return fmt.Errorf("cors allow origins are required when credentials are allowed (%s policy)", name)
+		}
+	}
+
+	return nil
+}
+
+// NewCORSMiddleware creates a middleware applying the default CORS policy,
+// or the policy of the group with the longest path prefix matching the
+// request. It runs for every request so preflights reach the right policy
+func NewCORSMiddleware(defaultPolicy config.CORSPolicy, groups []config.CORSPolicy) (gin.HandlerFunc, error) {
+	conf, err := newCORSConfig(defaultPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultHandler := cors.New(conf)
+
+	var routes []corsRoute
+	for _, group := range groups {
+		conf, err := newCORSConfig(group)
+		if err != nil {
+			return nil, err
+		}
+
+		handler := cors.New(conf)
+		for _, path := range group.Paths {
+			routes = append(routes, corsRoute{prefix: path, handler: handler})
+		}
+	}
+
+	return func(c *gin.Context) {
+		handler := defaultHandler
+		matched := ""
+
+		for _, route := range routes {
+			if strings.HasPrefix(c.Request.URL.Path, route.prefix) && len(route.prefix) > len(matched) {
+				handler = route.handler
+				matched = route.prefix
+			}
+		}
+
+		handler(c)
+	}, nil
+}
@@ -1,25 +1,38 @@
 package server
 
 import (
+	"context"
 	"errors"
-	"github.com/gin-contrib/cors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/tapiaw38/auth-api/config"
 	"github.com/tapiaw38/auth-api/internal/cache"
 	"github.com/tapiaw38/auth-api/internal/database"
+	"github.com/tapiaw38/auth-api/internal/events"
+	"github.com/tapiaw38/auth-api/internal/mailer"
 	"github.com/tapiaw38/auth-api/internal/rabbitmq"
 	"github.com/tapiaw38/auth-api/internal/repository"
 	"github.com/tapiaw38/auth-api/internal/sso"
 	"github.com/tapiaw38/auth-api/internal/utils"
-	"log"
+	"github.com/tapiaw38/auth-api/internal/webhooks"
 )
 
+// ShutdownTimeout bounds the wait for the requests in flight on shutdown
+const ShutdownTimeout = 15 * time.Second
+
 // Server is the server interface
 type Server interface {
 	Config() *config.Config
 	S3() *utils.S3Client
 	Google() *sso.GoogleClient
-	Mail() *utils.EmailSMTPConfig
+	Mail() mailer.EmailSender
 	Redis() *cache.RedisCache
 	Rabbit() *rabbitmq.RabbitMQConfig
 }
@@ -30,9 +43,10 @@ type Broker struct {
 	engine *gin.Engine
 	s3     *utils.S3Client
 	google *sso.GoogleClient
-	mail   *utils.EmailSMTPConfig
+	mail   mailer.EmailSender
 	redis  *cache.RedisCache
 	rabbit *rabbitmq.RabbitMQConfig
+	cors   gin.HandlerFunc
 }
 
 // Config returns the server configuration
@@ -51,7 +65,7 @@ func (b *Broker) Google() *sso.GoogleClient {
 }
 
 // Mail returns the mail client
-func (b *Broker) Mail() *utils.EmailSMTPConfig {
+func (b *Broker) Mail() mailer.EmailSender {
 	return b.mail
 }
 
@@ -79,9 +93,41 @@ func New(config *config.Config) (*Broker, error) {
 		return nil, errors.New("database url is required")
 	}
 
+	// Browsers reject credentialed requests answered with a wildcard origin
+	err := validateCORSPolicies(config.CookieMode, config.CORS, config.CORSGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	corsMiddleware, err := NewCORSMiddleware(config.CORS, config.CORSGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	mail, err := mailer.New(&mailer.Config{
+		Driver: config.EmailDriver,
+		SMTP: mailer.SMTPConfig{
+			Host:         config.EmailHost,
+			Port:         config.EmailPort,
+			HostUser:     config.EmailHostUser,
+			HostPassword: config.EmailHostPassword,
+			Security:     config.EmailSecurity,
+		},
+		Mailgun: mailer.MailgunConfig{
+			Domain:        config.MailgunDomain,
+			PrivateAPIKey: config.MailgunAPIKey,
+			APIBase:       config.MailgunAPIBase,
+		},
+		OutboxDir: config.EmailOutboxDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	broker := &Broker{
 		config: config,
 		engine: gin.Default(),
+		cors:   corsMiddleware,
 		s3: utils.NewSession(&utils.S3Config{
 			AWSRegion:          config.AWSRegion,
 			AWSAccessKeyID:     config.AWSAccessKeyID,
@@ -93,12 +139,7 @@ func New(config *config.Config) (*Broker, error) {
 			ClientSecret: config.GoogleClientSecret,
 			FrontendURL:  config.FrontendURL,
 		}),
-		mail: utils.NewEmailSMTPConfig(&utils.EmailSMTPConfig{
-			Host:         config.EmailHost,
-			Port:         config.EmailPort,
-			HostUser:     config.EmailHostUser,
-			HostPassword: config.EmailHostPassword,
-		}),
+		mail: mail,
 		redis: cache.NewRedisCache(&cache.RedisCache{
 			Host:     config.RedisHost,
 			Password: config.RedisPassword,
@@ -106,10 +147,12 @@ func New(config *config.Config) (*Broker, error) {
 			Expires:  config.RedisExpires,
 		}),
 		rabbit: rabbitmq.NewRabbitMQConfig(&rabbitmq.RabbitMQConfig{
-			Host:     config.RabbitMQHost,
-			Port:     config.RabbitMQPort,
-			User:     config.RabbitMQUser,
-			Password: config.RabbitMQPassword,
+			Host:            config.RabbitMQHost,
+			Port:            config.RabbitMQPort,
+			User:            config.RabbitMQUser,
+			Password:        config.RabbitMQPassword,
+			EventsExchange:  config.EventsExchange,
+			ChannelPoolSize: config.RabbitMQChannelPoolSize,
 		}),
 	}
 
@@ -127,15 +170,19 @@ func (b *Broker) Serve(binder func(s Server, e *gin.Engine)) {
 		b.config.Host = "http://localhost:" + b.config.Port
 	}
 
-	// Connect to RabbitMQ
+	// Stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Connect to RabbitMQ, the connection is dialed and kept in the background
 	conn := b.rabbit.Connection()
 	defer conn.Close()
 
 	// Consumer for sending emails
 	go func() {
-		err := conn.ConsumeEmailMessage(b.mail.SendEmail)
+		err := conn.ConsumeEmailMessage(b.mail)
 		if err != nil {
-			log.Fatalf("Failed to consume messages: %s", err)
+			log.Printf("Failed to consume messages: %s", err)
 		}
 	}()
 
@@ -160,19 +207,36 @@ func (b *Broker) Serve(binder func(s Server, e *gin.Engine)) {
 	// Set the repository
 	repository.SetRepository(rep)
 
+	// Drop the cached users on every write made to them
+	repository.SetInvalidator(b.redis)
+
+	// Email templates edited by the admins override the embedded defaults
+	mailer.SetOverrides(repository.ListEmailTemplateByName)
+
+	// The background workers are waited for before the connections close
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	workers.Add(2)
+
+	// Relay the domain events and emails stored in the outbox to RabbitMQ
+	go func() {
+		defer workers.Done()
+		events.Relay(workerCtx, conn, b.config.OutboxPollInterval*time.Second)
+	}()
+
+	// Deliver the queued webhooks
+	go func() {
+		defer workers.Done()
+		webhooks.Worker(workerCtx, webhooks.NewSender(), b.config.WebhookPollInterval*time.Second)
+	}()
+
 	// Set the router as the default one shipped with Gin
 	b.engine = gin.Default()
 
-	// Set the cors
-	conf := cors.DefaultConfig()
-	conf.AllowOrigins = []string{"*"}
-	conf.AllowCredentials = true
-	conf.AllowMethods = []string{"*"}
-	conf.AllowHeaders = []string{"*"}
-	conf.ExposeHeaders = []string{"*"}
-
 	// Use the cors
-	b.engine.Use(cors.New(conf))
+	b.engine.Use(b.cors)
 	//Use the recovery middleware
 	b.engine.Use(gin.Recovery())
 	// Use the logger middleware
@@ -182,9 +246,42 @@ func (b *Broker) Serve(binder func(s Server, e *gin.Engine)) {
 	binder(b, b.engine)
 
 	// Start and run the server
-	err = b.engine.Run(":" + b.config.Port)
+	srv := &http.Server{
+		Addr:    ":" + b.config.Port,
+		Handler: b.engine,
+	}
+
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+
+	// Finish the requests in flight and the background workers, then the
+	// deferred calls stop RabbitMQ
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
 
+	// Let the relay and the webhook worker finish their batch
+	stopWorkers()
+	workers.Wait()
+
+	err = rep.Close()
+	if err != nil {
+		log.Println(err)
+	}
+
+	err = b.redis.Close()
+	if err != nil {
+		log.Println(err)
+	}
 }
@@ -1,11 +1,18 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -54,9 +61,9 @@ func ConvertInterfaceToString(value interface{}) (string, error) {
 // Generate a token
 func GenerateToken() (string, error) {
 	// Create a random byte slice.
-	tokenBytes := make([]byte, 16)
+	tokenBytes := make([]byte, 32)
 
-	_, err := rand.Read(tokenBytes)
+	_, err := crand.Read(tokenBytes)
 	if err != nil {
 		return "", err
 	}
@@ -67,6 +74,12 @@ func GenerateToken() (string, error) {
 	return token, nil
 }
 
+// HashToken returns the hex encoded SHA-256 hash of a token
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 // HashPassword hashes a password
 func HashPassword(password string) ([]byte, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), HASH_COST)
@@ -76,3 +89,56 @@ func HashPassword(password string) ([]byte, error) {
 
 	return bytes, nil
 }
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor encodes the position of a row ordered by (created_at, id)
+// into an opaque pagination cursor
+func EncodeCursor(createdAt time.Time, id string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor decodes a pagination cursor created by EncodeCursor
+func DecodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return createdAt, parts[1], nil
+}
+
+// EncodeKeysetCursor encodes the sort values of a row, its id last, into an
+// opaque pagination cursor
+func EncodeKeysetCursor(values ...string) string {
+	raw, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeKeysetCursor decodes a pagination cursor created by EncodeKeysetCursor
+func DecodeKeysetCursor(cursor string) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var values []string
+
+	if err = json.Unmarshal(raw, &values); err != nil || len(values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return values, nil
+}
@@ -0,0 +1,309 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"github.com/tapiaw38/auth-api/internal/models"
+	"github.com/tapiaw38/auth-api/internal/repository"
+)
+
+// Headers sent with every delivery. The signature is the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// MaxAttempts is the number of attempts before a delivery is failed
+	MaxAttempts = 8
+	// RetryBaseDelay is the delay before the first retry, doubled on each one
+	RetryBaseDelay = 30 * time.Second
+	// RetryMaxDelay caps the delay between two attempts
+	RetryMaxDelay = 6 * time.Hour
+	// RequestTimeout bounds the time a receiver has to answer
+	RequestTimeout = 10 * time.Second
+	// BatchSize is the maximum number of deliveries sent per poll
+	BatchSize = 20
+)
+
+// Sign returns the signature of a delivery body sent at the given time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received delivery, rejecting deliveries
+// whose timestamp is further than tolerance from now to prevent replays
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// Backoff returns the delay before the next attempt of a delivery that
+// already failed the given number of times
+func Backoff(attempts int) time.Duration {
+	delay := RetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= RetryMaxDelay {
+			return RetryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// Enqueue creates a delivery of an event for every active webhook
+// subscribed to its type. Called inside repository.WithTx the deliveries
+// are only kept if the transaction commits
+func Enqueue(ctx context.Context, event *models.Event) error {
+	webhooks, err := repository.ListWebhookByEventType(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		err = enqueue(ctx, webhook.Id, event.Id, event.Type, payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Redeliver queues a new delivery with the payload of a previous one, the
+// previous delivery is kept in the history
+func Redeliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return enqueue(ctx, delivery.WebhookId, delivery.EventId, delivery.EventType, delivery.Payload)
+}
+
+// enqueue inserts a pending delivery
+func enqueue(ctx context.Context, webhookId string, eventId string, eventType string, payload []byte) error {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	return repository.InsertWebhookDelivery(ctx, &models.WebhookDelivery{
+		Id:        id.String(),
+		WebhookId: webhookId,
+		EventId:   eventId,
+		EventType: eventType,
+		Payload:   payload,
+	})
+}
+
+// ErrPrivateAddress is returned when a webhook targets a loopback, private
+// or link-local address, such as a cloud metadata endpoint
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// IsPublicIP reports whether a webhook may be delivered to the address
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// ValidateURL checks that a webhook url is http or https and that its host
+// only resolves to public addresses
+func ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("invalid url")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+// Sender posts deliveries to the webhooks
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender creates a sender with the default request timeout. It only
+// connects to public addresses, checked once the host is resolved so that
+// neither a changed DNS record nor a redirect reaches the internal network
+func NewSender() *Sender {
+	dialer := &net.Dialer{
+		Timeout: RequestTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Sender{
+		Client: &http.Client{Timeout: RequestTimeout, Transport: transport},
+	}
+}
+
+// Send posts a signed delivery to a webhook and returns the response
+// status code. Any status other than 2xx is an error
+func (s *Sender) Send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.Id)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// RecordAttempt updates a delivery with the result of an attempt, scheduling
+// a retry with exponential backoff until MaxAttempts is reached
+func RecordAttempt(delivery *models.WebhookDelivery, statusCode int, err error, now time.Time) {
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.NextAttemptAt = now
+
+	if err == nil {
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.WebhookDeliveryFailed
+		return
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+}
+
+// Worker sends the due deliveries every interval until the context is done
+func Worker(ctx context.Context, sender *Sender, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := deliverBatch(ctx, sender); err != nil {
+				log.Printf("webhooks: %s", err)
+			}
+		}
+	}
+}
+
+// deliverBatch claims and sends one batch of due deliveries
+func deliverBatch(ctx context.Context, sender *Sender) error {
+	// The lease outlives a full batch of timed out requests
+	deliveries, err := repository.ClaimWebhookDeliveries(ctx, BatchSize, BatchSize*RequestTimeout)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := repository.GetWebhookById(ctx, delivery.WebhookId)
+		if err != nil {
+			return err
+		}
+
+		if webhook == nil || !webhook.IsActive {
+			// Deliveries queued before the webhook was disabled are dropped
+			delivery.Status = models.WebhookDeliveryFailed
+			delivery.LastError = "webhook disabled"
+		} else {
+			statusCode, err := sender.Send(ctx, webhook, delivery)
+			RecordAttempt(delivery, statusCode, err, time.Now())
+		}
+
+		err = repository.UpdateWebhookDelivery(ctx, delivery)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tapiaw38/auth-api/internal/models"
+)
+
+func TestSend(t *testing.T) {
+	webhook := &models.Webhook{Id: "webhook", Secret: "secret"}
+	delivery := &models.WebhookDelivery{
+		Id:        "delivery",
+		EventType: models.EventUserCreated,
+		Payload:   []byte(`{"id":"event","type":"user.created"}`),
+	}
+
+	t.Run("should post a signed delivery", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, models.EventUserCreated, r.Header.Get(EventHeader))
+			assert.Equal(t, "delivery", r.Header.Get(DeliveryHeader))
+			assert.True(t, Verify("secret", r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), body, time.Minute))
+			assert.False(t, Verify("other", r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader), body, time.Minute))
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer receiver.Close()
+
+		webhook.Url = receiver.URL
+
+		statusCode, err := (&Sender{Client: receiver.Client()}).Send(context.Background(), webhook, delivery)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, statusCode)
+	})
+
+	t.Run("should fail on a non 2xx response", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer receiver.Close()
+
+		webhook.Url = receiver.URL
+
+		statusCode, err := (&Sender{Client: receiver.Client()}).Send(context.Background(), webhook, delivery)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, statusCode)
+	})
+
+	t.Run("should refuse a private address", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("the private receiver was reached")
+		}))
+		defer receiver.Close()
+
+		webhook.Url = receiver.URL
+
+		_, err := NewSender().Send(context.Background(), webhook, delivery)
+		assert.ErrorIs(t, err, ErrPrivateAddress)
+
+		assert.ErrorIs(t, ValidateURL(context.Background(), receiver.URL), ErrPrivateAddress)
+		assert.ErrorIs(t, ValidateURL(context.Background(), "http://169.254.169.254/latest/meta-data"), ErrPrivateAddress)
+		assert.ErrorIs(t, ValidateURL(context.Background(), "http://10.0.0.1"), ErrPrivateAddress)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("should reject a stale timestamp", func(t *testing.T) {
+		body := []byte("{}")
+		old := time.Now().Add(-time.Hour).Unix()
+
+		signature := Sign("secret", old, body)
+		assert.False(t, Verify("secret", strconv.FormatInt(old, 10), signature, body, time.Minute))
+	})
+}
+
+func TestRecordAttempt(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should schedule retries with exponential backoff", func(t *testing.T) {
+		delivery := &models.WebhookDelivery{}
+
+		RecordAttempt(delivery, http.StatusBadGateway, errors.New("unexpected status 502"), now)
+		assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+		assert.Equal(t, now.Add(RetryBaseDelay), delivery.NextAttemptAt)
+
+		RecordAttempt(delivery, 0, errors.New("timeout"), now)
+		assert.Equal(t, now.Add(2*RetryBaseDelay), delivery.NextAttemptAt)
+		assert.Equal(t, 2, delivery.Attempts)
+	})
+
+	t.Run("should fail after the last attempt", func(t *testing.T) {
+		delivery := &models.WebhookDelivery{Attempts: MaxAttempts - 1}
+
+		RecordAttempt(delivery, 0, errors.New("timeout"), now)
+		assert.Equal(t, models.WebhookDeliveryFailed, delivery.Status)
+	})
+
+	t.Run("should succeed", func(t *testing.T) {
+		delivery := &models.WebhookDelivery{Attempts: 3, LastError: "timeout"}
+
+		RecordAttempt(delivery, http.StatusOK, nil, now)
+		assert.Equal(t, models.WebhookDeliverySucceeded, delivery.Status)
+		assert.Equal(t, &now, delivery.DeliveredAt)
+		assert.Empty(t, delivery.LastError)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	t.Run("should be capped", func(t *testing.T) {
+		assert.Equal(t, RetryMaxDelay, Backoff(100))
+	})
+}
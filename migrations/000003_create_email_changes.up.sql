@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    confirm_token VARCHAR(255) UNIQUE NOT NULL,
+    cancel_token VARCHAR(255) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+ALTER TABLE email_changes
+    ADD COLUMN IF NOT EXISTS confirm_token VARCHAR(255) UNIQUE,
+    ADD COLUMN IF NOT EXISTS cancel_token VARCHAR(255) UNIQUE;
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS verified_email_token VARCHAR(255) UNIQUE,
+    ADD COLUMN IF NOT EXISTS verified_email_token_expiry TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS password_reset_token VARCHAR(255) UNIQUE,
+    ADD COLUMN IF NOT EXISTS password_reset_token_expiry TIMESTAMP NOT NULL DEFAULT NOW();
+
+DROP TABLE IF EXISTS one_time_tokens;
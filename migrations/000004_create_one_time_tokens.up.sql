@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS one_time_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS one_time_tokens_user_id_purpose_idx ON one_time_tokens (user_id, purpose);
+
+-- Keep the links already sent working by storing the hash of pending tokens
+INSERT INTO one_time_tokens (id, user_id, purpose, token_hash, expires_at)
+SELECT md5(random()::text), id, 'verify_email', encode(sha256(verified_email_token::bytea), 'hex'), verified_email_token_expiry
+FROM users
+WHERE verified_email_token IS NOT NULL AND verified_email_token <> '' AND verified_email = FALSE;
+
+INSERT INTO one_time_tokens (id, user_id, purpose, token_hash, expires_at)
+SELECT md5(random()::text), id, 'reset_password', encode(sha256(password_reset_token::bytea), 'hex'), password_reset_token_expiry
+FROM users
+WHERE password_reset_token IS NOT NULL AND password_reset_token <> '';
+
+INSERT INTO one_time_tokens (id, user_id, purpose, token_hash, expires_at)
+SELECT md5(random()::text), user_id, 'email_change_confirm', encode(sha256(confirm_token::bytea), 'hex'), expires_at
+FROM email_changes;
+
+INSERT INTO one_time_tokens (id, user_id, purpose, token_hash, expires_at)
+SELECT md5(random()::text), user_id, 'email_change_cancel', encode(sha256(cancel_token::bytea), 'hex'), expires_at
+FROM email_changes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS verified_email_token,
+    DROP COLUMN IF EXISTS verified_email_token_expiry,
+    DROP COLUMN IF EXISTS password_reset_token,
+    DROP COLUMN IF EXISTS password_reset_token_expiry;
+
+ALTER TABLE email_changes
+    DROP COLUMN IF EXISTS confirm_token,
+    DROP COLUMN IF EXISTS cancel_token;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS sessions_token_family_idx;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS refresh_token_hash,
+    DROP COLUMN IF EXISTS refresh_token_expires_at;
@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS refresh_token_hash CHAR(64),
+    ADD COLUMN IF NOT EXISTS refresh_token_expires_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_token_family_idx ON sessions (token_family);
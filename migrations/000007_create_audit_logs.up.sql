@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id VARCHAR(32) PRIMARY KEY,
+    actor_id VARCHAR(32),
+    target_id VARCHAR(32),
+    action VARCHAR(64) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_created_at_id_idx ON audit_logs (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_logs_actor_id_idx ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS audit_logs_target_id_idx ON audit_logs (target_id);
+CREATE INDEX IF NOT EXISTS audit_logs_action_idx ON audit_logs (action);
+
+-- Audit logs are append only, rows can never be changed or removed
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_logs_append_only
+BEFORE UPDATE OR DELETE ON audit_logs
+FOR EACH ROW EXECUTE PROCEDURE audit_logs_append_only();
+
+CREATE TRIGGER audit_logs_no_truncate
+BEFORE TRUNCATE ON audit_logs
+FOR EACH STATEMENT EXECUTE PROCEDURE audit_logs_append_only();
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id VARCHAR(32) PRIMARY KEY,
+    message JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_pending_idx ON email_outbox (created_at) WHERE published_at IS NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS email_templates (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    locale VARCHAR(16) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    html TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (name, locale)
+);
@@ -0,0 +1,8 @@
+DELETE FROM email_templates WHERE template_set <> '';
+ALTER TABLE email_templates DROP CONSTRAINT IF EXISTS email_templates_name_locale_template_set_key;
+ALTER TABLE email_templates ADD CONSTRAINT email_templates_name_locale_key UNIQUE (name, locale);
+ALTER TABLE email_templates DROP COLUMN IF EXISTS template_set;
+
+ALTER TABLE users DROP COLUMN IF EXISTS application_id;
+
+DROP TABLE IF EXISTS applications;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS applications (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    frontend_url TEXT NOT NULL,
+    sender_name VARCHAR(128) NOT NULL,
+    sender_address VARCHAR(255) NOT NULL,
+    logo_url TEXT NOT NULL DEFAULT '',
+    template_set VARCHAR(64) NOT NULL DEFAULT '',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS application_id VARCHAR(32) REFERENCES applications(id) ON DELETE SET NULL;
+
+-- A template set holds the overrides of an application, the empty set
+-- applies to every application
+ALTER TABLE email_templates ADD COLUMN IF NOT EXISTS template_set VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE email_templates DROP CONSTRAINT IF EXISTS email_templates_name_locale_key;
+ALTER TABLE email_templates ADD CONSTRAINT email_templates_name_locale_template_set_key UNIQUE (name, locale, template_set);
@@ -0,0 +1,10 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS organization_id;
+
+DELETE FROM user_roles WHERE organization_id IS NOT NULL;
+DROP INDEX IF EXISTS user_roles_organization_key;
+DROP INDEX IF EXISTS user_roles_global_key;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_pkey PRIMARY KEY (user_id, role_id);
+
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    slug VARCHAR(64) UNIQUE NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    organization_id VARCHAR(32) NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id VARCHAR(32) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    invited_by VARCHAR(32) REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT memberships_pkey PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships (user_id);
+
+-- A role granted without an organization is global, the others only apply
+-- within their organization
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS organization_id VARCHAR(32) REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE user_roles DROP CONSTRAINT IF EXISTS user_roles_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS user_roles_global_key ON user_roles (user_id, role_id) WHERE organization_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS user_roles_organization_key ON user_roles (organization_id, user_id, role_id) WHERE organization_id IS NOT NULL;
+
+-- The organization selected by the tokens of a session
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS organization_id VARCHAR(32) REFERENCES organizations(id) ON DELETE SET NULL;
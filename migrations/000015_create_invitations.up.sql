@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id VARCHAR(32) PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    role_ids TEXT[] NOT NULL DEFAULT '{}',
+    application_id VARCHAR(32) REFERENCES applications(id) ON DELETE SET NULL,
+    locale VARCHAR(16) NOT NULL DEFAULT 'es',
+    invited_by VARCHAR(32) REFERENCES users(id) ON DELETE SET NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    accepted_by VARCHAR(32) REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON invitations (lower(email));
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS user_roles_role_id_idx;
+DROP INDEX IF EXISTS users_verified_email_idx;
+DROP INDEX IF EXISTS users_is_active_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+
+DROP INDEX IF EXISTS users_username_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_last_name_trgm_idx;
+DROP INDEX IF EXISTS users_first_name_trgm_idx;
@@ -0,0 +1,12 @@
+-- Trigram indexes serve the ILIKE '%text%' search of the users listing
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_first_name_trgm_idx ON users USING GIN (first_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_last_name_trgm_idx ON users USING GIN (last_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN (username gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS users_is_active_idx ON users (is_active);
+CREATE INDEX IF NOT EXISTS users_verified_email_idx ON users (verified_email);
+CREATE INDEX IF NOT EXISTS user_roles_role_id_idx ON user_roles (role_id);
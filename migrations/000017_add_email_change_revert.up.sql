@@ -0,0 +1,4 @@
+-- A confirmed change is kept until its cancel link expires, the link sent to
+-- the old address then reverts it
+ALTER TABLE email_changes ADD COLUMN IF NOT EXISTS old_email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE email_changes ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMP;
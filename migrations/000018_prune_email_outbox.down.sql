@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS email_outbox_created_at_idx;
+
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS published_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS email_outbox_pending_idx ON email_outbox (created_at) WHERE published_at IS NULL;
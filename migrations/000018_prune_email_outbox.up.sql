@@ -0,0 +1,6 @@
+DELETE FROM email_outbox WHERE published_at IS NOT NULL;
+
+DROP INDEX IF EXISTS email_outbox_pending_idx;
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS published_at;
+
+CREATE INDEX IF NOT EXISTS email_outbox_created_at_idx ON email_outbox (created_at);
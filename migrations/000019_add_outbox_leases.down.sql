@@ -0,0 +1,2 @@
+ALTER TABLE email_outbox DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS locked_until;
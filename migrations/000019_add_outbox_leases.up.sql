@@ -0,0 +1,4 @@
+-- The relays lease the rows they publish instead of locking them in a
+-- transaction held open while publishing
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
@@ -0,0 +1,11 @@
+// Package templates embeds the default email templates, so the binary
+// does not depend on its working directory
+package templates
+
+import "embed"
+
+// FS holds a directory per locale with the <name>.html templates, their
+// optional <name>.txt plain text alternatives, and the messages.json catalog
+//
+//go:embed */*.html */*.txt */messages.json
+var FS embed.FS